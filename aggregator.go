@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/config"
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+)
+
+// fetches every feed whose next fetch is due. A pool of workers fetches up to agg_workers feeds at once,
+// each claiming the next due feed only once it is free so no claim runs out while it waits its turn.
+// Each feed gets its own timeout so one slow server can't hold up a worker forever. After a successful
+// fetch the feed's next fetch is scheduled from how often it posts and what the feed and server ask for,
+// never sooner than the interval. A feed that fails is recorded in feed_failures and retried on a
+// backoff instead, and the workers carry on with the next one. WebSub subscriptions that are nearly up
+// are renewed first. Returns once there are no feeds left that were due when it started, or the database
+// can't be reached to claim more. Feeds that come due while it is running are left for the next call, so
+// a long pass can't keep going forever. When ctx is cancelled no more feeds are claimed, and the fetches
+// in progress get shutdown_timeout to finish before they are cancelled too. Every fetch is recorded in
+// feed_fetches, and fetches older than fetch_history_days are deleted first
+func scrapeFeeds(ctx context.Context, s *state, interval time.Duration) {
+	started := time.Now()
+	workers := s.cfg.AggWorkerCount()
+	settings := newScrapeSettings(s, interval)
+	work, cancel := withGrace(ctx, settings.grace)
+	defer cancel()
+	pruneFetchHistory(work, s)
+	if s.cfg.WebSubCallback != "" {
+		renewWebSubSubscriptions(work, s)
+	}
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				due, err := claimFeeds(ctx, s, settings.timeout, 1, started)
+				if err != nil {
+					if ctx.Err() == nil {
+						fmt.Printf("Could not claim feeds to fetch: %v\n", err)
+					}
+					return
+				}
+				if len(due) == 0 {
+					return
+				}
+				processFeed(work, s, due[0], settings)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// hands feeds to the workers until ctx is cancelled. Any feeds left over aren't fetched
+func queueFeeds(ctx context.Context, queue chan<- database.Feed, feeds []database.Feed) {
+	for _, feed := range feeds {
+		select {
+		case queue <- feed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// returns a context that is cancelled grace after ctx is, so that work already under way when ctx is
+// cancelled has a chance to finish rather than being cut off part way through saving
+func withGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceful, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return graceful, func() {
+		stop()
+		cancel()
+	}
+}
+
+// the interval refresh retries a failed feed on, in place of agg's interval
+const refreshInterval = time.Minute
+
+// how long each fetch can take, the interval failed fetches are retried on, the shortest and longest
+// time to leave between successful fetches of a feed, and how long fetches can carry on after being stopped
+type scrapeSettings struct {
+	timeout  time.Duration
+	interval time.Duration
+	minGap   time.Duration
+	maxGap   time.Duration
+	grace    time.Duration
+}
+
+// reads the scrape settings from the config file. Feeds are never fetched more often than the interval
+func newScrapeSettings(s *state, interval time.Duration) scrapeSettings {
+	settings, err := parseScrapeSettings(*s.cfg, interval)
+	checkError(err)
+	return settings
+}
+
+// parses the scrape settings in a config, returning an error if any of them are invalid
+func parseScrapeSettings(cfg config.Config, interval time.Duration) (scrapeSettings, error) {
+	timeout, err := cfg.FetchTimeoutDuration()
+	if err != nil {
+		return scrapeSettings{}, err
+	}
+	minGap, err := cfg.MinRefreshDuration()
+	if err != nil {
+		return scrapeSettings{}, err
+	}
+	maxGap, err := cfg.MaxRefreshDuration()
+	if err != nil {
+		return scrapeSettings{}, err
+	}
+	grace, err := cfg.ShutdownTimeoutDuration()
+	if err != nil {
+		return scrapeSettings{}, err
+	}
+	return scrapeSettings{
+		timeout:  timeout,
+		interval: interval,
+		minGap:   max(minGap, interval),
+		maxGap:   maxGap,
+		grace:    grace,
+	}, nil
+}
+
+// scrapes a feed that has been claimed and releases the claim. A failure is recorded and the feed retried
+// on a backoff, otherwise its next fetch is scheduled. Items that couldn't be saved are recorded too, but
+// as the rest of the feed was fine they don't count towards disabling it. A fetch cut off because ctx was
+// cancelled isn't counted as a failure, the feed is left for its claim to run out instead. Every other
+// fetch is recorded in the fetch history. If the feed was merged into another one the bookkeeping is done
+// by finishMergedFetch instead. Returns what came of the scrape
+func processFeed(ctx context.Context, s *state, feed database.Feed, settings scrapeSettings) (scrapeResult, error) {
+	started := time.Now()
+	fetchCtx, cancel := context.WithTimeout(ctx, settings.timeout)
+	result, err := scrapeFeed(fetchCtx, s, feed)
+	cancel()
+	if err != nil && ctx.Err() != nil {
+		return result, err
+	}
+	if result.feed.ID != feed.ID {
+		finishMergedFetch(ctx, s, result.feed, started, result, err, settings)
+		return result, err
+	}
+	recordFetch(ctx, s, feed, started, result, err)
+	if err != nil && !errors.Is(err, errSavePosts) {
+		recordFailure(ctx, s, feed, err, settings.interval)
+		return result, err
+	}
+	if err != nil {
+		recordSaveFailure(ctx, s, feed, err)
+	}
+	markErr := s.db.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		ID:          feed.ID,
+		NextFetchAt: sql.NullTime{Time: nextFetchAt(ctx, s, feed, result, settings), Valid: true},
+	})
+	if markErr != nil {
+		fmt.Printf("Could not mark %v as fetched: %v\n", feed.Name, markErr)
+	}
+	return result, err
+}
+
+// does the bookkeeping for a fetch of a feed that moved to the URL of another feed and was merged into it.
+// The fetch is recorded against the other feed, but we never claimed that one, so its claim and failure
+// state are left to whoever has it and only when it was fetched and its next fetch are updated. If the
+// fetch went wrong after the merge the failure is recorded and the feed keeps its own schedule
+func finishMergedFetch(ctx context.Context, s *state, target database.Feed, started time.Time, result scrapeResult, err error, settings scrapeSettings) {
+	recordFetch(ctx, s, target, started, result, err)
+	if err != nil {
+		recordSaveFailure(ctx, s, target, err)
+		return
+	}
+	setErr := s.db.SetFeedNextFetch(ctx, database.SetFeedNextFetchParams{
+		ID:          target.ID,
+		NextFetchAt: sql.NullTime{Time: nextFetchAt(ctx, s, target, result, settings), Valid: true},
+	})
+	if setErr != nil {
+		fmt.Printf("Could not schedule the next fetch of %v: %v\n", target.Name, setErr)
+	}
+}
+
+// schedules the next fetch of a feed after a successful scrape, falling back to minGap from now if the
+// schedule can't be worked out
+func nextFetchAt(ctx context.Context, s *state, feed database.Feed, result scrapeResult, settings scrapeSettings) time.Time {
+	next, err := scheduleNextFetch(ctx, s, feed, result, settings.minGap, settings.maxGap)
+	if err != nil {
+		fmt.Printf("Could not schedule the next fetch of %v: %v\n", feed.Name, err)
+		return time.Now().Add(settings.minGap)
+	}
+	return next
+}
+
+// claims up to limit feeds whose next fetch, or retry after a failure, was due by dueBefore. Claiming is done in a
+// single statement using FOR UPDATE SKIP LOCKED, so several agg processes can share the same database
+// without fetching the same feed twice. A claim is a lease that runs out after twice the fetch timeout,
+// so if a process dies part way through a feed another process picks it up once the lease expires.
+// MarkFeedFetched releases the claim when the fetch is finished
+func claimFeeds(ctx context.Context, s *state, timeout time.Duration, limit int, dueBefore time.Time) ([]database.Feed, error) {
+	return s.db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+		LeaseSeconds: claimLeaseSeconds(timeout),
+		DueBefore:    dueBefore,
+		BatchSize:    int32(limit),
+	})
+}
+
+// claims a single feed whether or not it is due, so it can be fetched on demand. Returns sql.ErrNoRows if
+// another process already has it claimed
+func claimFeed(ctx context.Context, s *state, timeout time.Duration, feed database.Feed) (database.Feed, error) {
+	return s.db.ClaimFeed(ctx, database.ClaimFeedParams{
+		LeaseSeconds: claimLeaseSeconds(timeout),
+		ID:           feed.ID,
+	})
+}
+
+// fetches the given feeds now, whether or not they are due, with the same workers, failure handling and
+// scheduling as scrapeFeeds. Prints what came of each feed. A failed refresh is retried as if agg were
+// running every refreshInterval. Like scrapeFeeds, cancelling ctx stops any more feeds being started and
+// gives the ones under way shutdown_timeout to finish
+func refreshFeeds(ctx context.Context, s *state, feeds []database.Feed) {
+	settings := newScrapeSettings(s, refreshInterval)
+	work, cancel := withGrace(ctx, settings.grace)
+	defer cancel()
+	queue := make(chan database.Feed)
+	var wg sync.WaitGroup
+	for range s.cfg.AggWorkerCount() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range queue {
+				fmt.Println(refreshFeed(work, s, feed, settings))
+			}
+		}()
+	}
+	queueFeeds(ctx, queue, feeds)
+	close(queue)
+	wg.Wait()
+}
+
+// refreshes a single feed and describes the outcome. Disabled feeds are skipped, as are feeds another
+// agg or refresh is already fetching
+func refreshFeed(ctx context.Context, s *state, feed database.Feed, settings scrapeSettings) string {
+	if feed.DisabledAt.Valid {
+		return fmt.Sprintf("%v: skipped, it is disabled. Run reenable %v first", feed.Name, feed.Url)
+	}
+	claimed, err := claimFeed(ctx, s, settings.timeout, feed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Sprintf("%v: skipped, it is already being fetched", feed.Name)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v: could not be claimed: %v", feed.Name, err)
+	}
+	result, err := processFeed(ctx, s, claimed, settings)
+	if err != nil && !errors.Is(err, errSavePosts) {
+		return fmt.Sprintf("%v: failed: %v", feed.Name, err)
+	}
+	if result.unchanged {
+		return fmt.Sprintf("%v: unchanged since it was last fetched", feed.Name)
+	}
+	counts := fmt.Sprintf("%v: %v new, %v updated, %v skipped", feed.Name, result.saved, result.updated, result.duplicates)
+	if err != nil {
+		return fmt.Sprintf("%v, some could not be saved: %v", counts, err)
+	}
+	return counts
+}
+
+// fetches a feed that has never been fetched so its posts show up in browse straight away, rather than
+// once agg gets to it, and prints how many posts were imported. Feeds that have been fetched before are
+// left to agg. A failed fetch is only reported, agg retries it as usual
+func backfillFeed(ctx context.Context, s *state, feed database.Feed) {
+	if feed.LastFetchedAt.Valid {
+		return
+	}
+	settings := newScrapeSettings(s, refreshInterval)
+	ctx, cancel := withGrace(ctx, settings.grace)
+	defer cancel()
+	claimed, err := claimFeed(ctx, s, settings.timeout, feed)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("%v is already being fetched, its posts will show up shortly\n", feed.Name)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Could not fetch %v now, agg will fetch it: %v\n", feed.Name, err)
+		return
+	}
+	result, err := processFeed(ctx, s, claimed, settings)
+	if err != nil && !errors.Is(err, errSavePosts) {
+		fmt.Printf("Could not fetch %v now, agg will retry it\n", feed.Name)
+		return
+	}
+	fmt.Printf("Imported %v posts from %v\n", result.saved, feed.Name)
+}
+
+// how long a claim lasts before another process can take the feed over
+func claimLeaseSeconds(timeout time.Duration) int32 {
+	lease := max(2*timeout, time.Minute)
+	return int32(lease.Seconds())
+}
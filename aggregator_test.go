@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestWithGrace checks that work carries on for the grace period after being stopped, and no longer
+func TestWithGrace(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	graceful, cancel := withGrace(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	stop()
+	if graceful.Err() != nil {
+		t.Errorf("Error testing grace period: expected the work to carry on but got %v", graceful.Err())
+	}
+	select {
+	case <-graceful.Done():
+	case <-time.After(time.Second):
+		t.Errorf("Error testing grace period: expected the work to be cancelled but it was still running")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import "strings"
+
+// the AtomFeed struct represents an Atom 1.0 document. Atom feeds are converted into an RSSFeed once
+// they have been parsed so the rest of the aggregator only has to deal with one shape of feed
+type AtomFeed struct {
+	Title    AtomText    `xml:"title"`
+	Subtitle AtomText    `xml:"subtitle"`
+	Links    []AtomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Entries  []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      AtomText       `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+	URI   string `xml:"uri"`
+}
+
+// Atom text constructs can be plain text, escaped html or inline xhtml. For xhtml the markup is nested
+// inside the element so we need the inner xml rather than the character data
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+// returns the text of the element, keeping the markup for inline xhtml
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.InnerXML)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// picks the link a reader would want to follow. Atom says a link with no rel is an alternate link,
+// and if there are no alternate links at all we fall back to the first link in the list
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+// converts the Atom feed into the RSSFeed struct used by scrapeFeeds. The summary is preferred for the
+// description, but plenty of feeds only publish content so that is used when there is no summary. Atom
+// ids are usually tag: or urn: URIs so they are never treated as permalinks
+func (a AtomFeed) toRSSFeed() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = a.Title.String()
+	feed.Channel.Link = alternateLink(a.Links)
+	feed.Channel.Description = a.Subtitle.String()
+	feed.Channel.AtomLinks = a.Links
+	for _, entry := range a.Entries {
+		item := RSSItem{
+			Title:       entry.Title.String(),
+			Link:        alternateLink(entry.Links),
+			Description: entry.Summary.String(),
+			Content:     entry.Content.String(),
+			PubDate:     entry.Published,
+			GUID:        RSSGUID{Value: entry.ID, IsPermaLink: "false"},
+		}
+		if item.Description == "" {
+			item.Description = entry.Content.String()
+		}
+		if item.PubDate == "" {
+			item.PubDate = entry.Updated
+		}
+		if len(entry.Authors) > 0 {
+			item.Author = entry.Authors[0].Name
+		}
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, category.Term)
+		}
+		for _, link := range entry.Links {
+			if link.Rel == "enclosure" {
+				item.Enclosures = append(item.Enclosures, RSSEnclosure{URL: link.Href, Type: link.Type, Length: link.Length})
+			}
+		}
+		feed.Channel.Item = append(feed.Channel.Item, item)
+	}
+	return &feed
+}
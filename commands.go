@@ -2,8 +2,15 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/ben-smith-404/blog-aggregator/internal/config"
@@ -19,30 +26,30 @@ type command struct {
 
 // commands is the list of instructions, and the map to their functions
 type commands struct {
-	command map[string]func(*state, command) error
+	command map[string]func(context.Context, *state, command) error
 }
 
 // the run method attepts to run the commands helper function, if there is no command of
 // that name it returns an error, otherwise it runs the function in the map. If there is an
 // error, it will return the error
-func (c *commands) run(s *state, cmd command) error {
+func (c *commands) run(ctx context.Context, s *state, cmd command) error {
 	handler, exists := c.command[cmd.name]
 	if !exists {
 		checkError(fmt.Errorf("there is no registered command called %v", cmd.name))
 	}
-	err := handler(s, cmd)
+	err := handler(ctx, s, cmd)
 	checkError(err)
 	return nil
 }
 
 // register adds a name: function pair to the commands struct
-func (c *commands) register(name string, f func(*state, command) error) {
+func (c *commands) register(name string, f func(context.Context, *state, command) error) {
 	c.command[name] = f
 }
 
 // Register all the commands we'll need
 func registerCommands() commands {
-	commands := commands{command: make(map[string]func(*state, command) error)}
+	commands := commands{command: make(map[string]func(context.Context, *state, command) error)}
 	commands.register("login", handlerLogin)
 	commands.register("register", handlerRegister)
 	commands.register("reset", handlerReset)
@@ -50,21 +57,26 @@ func registerCommands() commands {
 	commands.register("agg", handlerAgg)
 	commands.register("addfeed", middlewareLoggedIn(handlerAddFeed))
 	commands.register("feeds", handlerFeeds)
+	commands.register("reenable", handlerReenable)
 	commands.register("follow", middlewareLoggedIn(handlerFollow))
 	commands.register("following", middlewareLoggedIn(handlerFollowing))
 	commands.register("unfollow", middlewareLoggedIn(handleUnfollow))
 	commands.register("browse", middlewareLoggedIn(handleBrowse))
+	commands.register("download", middlewareLoggedIn(handlerDownload))
+	commands.register("fetch", handlerFetch)
+	commands.register("refresh", handlerRefresh)
+	commands.register("feedstats", handlerFeedStats)
 	return commands
 }
 
 // this is the helper function for the login command. it expects to be passed a command struct with
 // a maximum of one string in the arguments slice. it will attempt to set the current user to the
 // value of that string using the config in the state variable
-func handlerLogin(s *state, cmd command) error {
+func handlerLogin(ctx context.Context, s *state, cmd command) error {
 	if len(cmd.arguments) != 1 {
 		checkError(fmt.Errorf("1 argument expected, %v provided", len(cmd.arguments)))
 	}
-	user, err := s.db.GetUser(context.Background(), cmd.arguments[0])
+	user, err := s.db.GetUser(ctx, cmd.arguments[0])
 	checkError(err)
 	err = s.cfg.SetUser(user.Name)
 	checkError(err)
@@ -77,11 +89,11 @@ func handlerLogin(s *state, cmd command) error {
 // helper function for the register command. It takes a single parameter and creates them as a user
 // in the database. If the user already exists it will throw an error. it then sets that user as the
 // current user in the config file. It will print a message when it's successful
-func handlerRegister(s *state, cmd command) error {
+func handlerRegister(ctx context.Context, s *state, cmd command) error {
 	if len(cmd.arguments) != 1 {
 		checkError(fmt.Errorf("1 argument expected, %v provided", len(cmd.arguments)))
 	}
-	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
+	user, err := s.db.CreateUser(ctx, database.CreateUserParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -95,8 +107,8 @@ func handlerRegister(s *state, cmd command) error {
 }
 
 // a very dangerous command to make testing easier. Reset truncates the user table in the database
-func handlerReset(s *state, cmd command) error {
-	err := s.db.ResetUsers(context.Background())
+func handlerReset(ctx context.Context, s *state, cmd command) error {
+	err := s.db.ResetUsers(ctx)
 	checkError(err)
 	fmt.Println("The users database table was reset")
 	return nil
@@ -104,8 +116,8 @@ func handlerReset(s *state, cmd command) error {
 
 // the users function returns a list of users formatted as
 // * user name
-func handlerUsers(s *state, cmd command) error {
-	users, err := s.db.GetAllUsers(context.Background())
+func handlerUsers(ctx context.Context, s *state, cmd command) error {
+	users, err := s.db.GetAllUsers(ctx)
 	checkError(err)
 	for _, user := range users {
 		if user.Name == s.cfg.CurrentUserName {
@@ -117,41 +129,104 @@ func handlerUsers(s *state, cmd command) error {
 	return nil
 }
 
-// The aggregate function is designed to be started and left running in a separate terminal. It will fetch
-// one site at a time from the database using the scrapeFeeds function in rss.go. It has one parameter that
-// represents the time between requests. This is expected to be in the format "1s", "5s", "1h", etc. These
-// are then converted to a duration. To prevent accidantal DOS, durations less than 1 second are not allowed
-func handlerAgg(s *state, cmd command) error {
-	if len(cmd.arguments) != 1 {
-		checkError(fmt.Errorf("1 argument expected, %v provided", len(cmd.arguments)))
+// The aggregate function is designed to be started and left running in a separate terminal. Every tick it
+// fetches all the feeds that are due, using the scrapeFeeds function in aggregator.go. No feed is fetched
+// more than once a tick. It has one parameter that represents the time between ticks. This is expected to be in
+// the format "1s", "5s", "1h", etc. These are then converted to a duration. To prevent accidantal DOS,
+// durations less than 1 second are not allowed. The number of feeds fetched at once and the timeout for
+// each feed come from the config file. If websub_callback is set agg also listens for WebSub callbacks.
+// Interrupting agg stops it cleanly once the fetches in progress have finished, and sending it SIGHUP
+// reloads the config file once the pass under way has finished. Passing --once fetches the feeds that are
+// due and exits, for running from cron, in which case the duration is optional and should be how often
+// cron runs it
+func handlerAgg(ctx context.Context, s *state, cmd command) error {
+	once := slices.Contains(cmd.arguments, "--once")
+	arguments := slices.DeleteFunc(slices.Clone(cmd.arguments), func(argument string) bool {
+		return argument == "--once"
+	})
+	if len(arguments) > 1 || (len(arguments) == 0 && !once) {
+		checkError(fmt.Errorf("1 argument expected, %v provided", len(arguments)))
+	}
+	timeBetweenRequests := refreshInterval
+	if len(arguments) == 1 {
+		var err error
+		timeBetweenRequests, err = time.ParseDuration(arguments[0])
+		checkError(err)
 	}
-	timeBetweenRequests, err := time.ParseDuration(cmd.arguments[0])
-	checkError(err)
 	if timeBetweenRequests < time.Second {
 		return fmt.Errorf("the duration must be at least 1 second to prevent unintentional denial of service\n")
 	}
+	if once {
+		scrapeFeeds(ctx, s, timeBetweenRequests)
+		return nil
+	}
+	// closed once the WebSub listener has finished with the callbacks it was handling
+	webSubDone := make(chan struct{})
+	if s.cfg.WebSubCallback != "" {
+		// the address is bound before the first pass, so a port that is already in use stops agg before it
+		// starts rather than part way through fetching
+		listener, err := net.Listen("tcp", s.cfg.WebSubListenAddress())
+		checkError(err)
+		go func() {
+			defer close(webSubDone)
+			err := serveWebSub(ctx, s, listener)
+			if err != nil {
+				fmt.Printf("Stopped listening for WebSub callbacks, pushed feeds will still be polled: %v\n", err)
+			}
+		}()
+	} else {
+		close(webSubDone)
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
 	ticker := time.NewTicker(timeBetweenRequests)
-	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+	defer ticker.Stop()
+	scrapeFeeds(ctx, s, timeBetweenRequests)
+	for {
+		select {
+		case <-ctx.Done():
+			<-webSubDone
+			fmt.Println("agg stopped")
+			return nil
+		case <-hangup:
+			reloadConfig(s)
+		case <-ticker.C:
+			// a reload sent while the last pass was running is applied before the next one starts, rather
+			// than waiting on whichever of the two select happens to pick
+			select {
+			case <-hangup:
+				reloadConfig(s)
+			default:
+			}
+			scrapeFeeds(ctx, s, timeBetweenRequests)
+		}
 	}
 }
 
 // add a feed to the database with a name, URL, and as the logged in user. It requres 2 parameters to be
-// passed in, name and URL. It also creates a record that the logged in user is following a feed
-func handlerAddFeed(s *state, cmd command, currentUser database.User) error {
+// passed in, name and URL. The URL can be a web page rather than the feed itself, in which case the feed
+// is discovered from the page. It also creates a record that the logged in user is following a feed, and
+// fetches the feed straight away so its posts can be browsed
+func handlerAddFeed(ctx context.Context, s *state, cmd command, currentUser database.User) error {
 	if len(cmd.arguments) != 2 {
 		checkError(fmt.Errorf("2 arguments expected, %v provided", len(cmd.arguments)))
 	}
-	dbFeed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+	discovered, err := chooseFeed(ctx, s.fetcher, cmd.arguments[1])
+	checkError(err)
+	if discovered.URL != cmd.arguments[1] {
+		fmt.Printf("Using the feed at %v\n", discovered.URL)
+	}
+	dbFeed, err := s.db.CreateFeed(ctx, database.CreateFeedParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Name:      cmd.arguments[0],
-		Url:       cmd.arguments[1],
+		Url:       discovered.URL,
 		UserID:    currentUser.ID,
 	})
 	checkError(err)
-	_, err = s.db.CreateFeedFollower(context.Background(), database.CreateFeedFollowerParams{
+	_, err = s.db.CreateFeedFollower(ctx, database.CreateFeedFollowerParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -160,28 +235,154 @@ func handlerAddFeed(s *state, cmd command, currentUser database.User) error {
 	})
 	checkError(err)
 	fmt.Printf("New feed %v added. Followed by %v\n", dbFeed.Name, currentUser.Name)
+	backfillFeed(ctx, s, dbFeed)
 	return nil
 }
 
-// prints a list of feeds and the name of the user who created each feed
-func handlerFeeds(s *state, cmd command) error {
-	feeds, err := s.db.GetFeedsAndUserName(context.Background())
+// prints a list of feeds and the name of the user who created each feed, along with any warning from
+// the last time the feed was parsed. Passing --broken lists only the feeds that are failing to fetch, and
+// --status shows a table of how every feed's fetches are going
+func handlerFeeds(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.arguments) > 1 || (len(cmd.arguments) == 1 && cmd.arguments[0] != "--broken" && cmd.arguments[0] != "--status") {
+		checkError(fmt.Errorf("the only arguments accepted are --broken and --status"))
+	}
+	if len(cmd.arguments) == 1 && cmd.arguments[0] == "--broken" {
+		return listBrokenFeeds(ctx, s)
+	}
+	if len(cmd.arguments) == 1 {
+		feeds, err := s.db.GetFeedStatuses(ctx)
+		checkError(err)
+		return printFeedStatuses(os.Stdout, feeds)
+	}
+	feeds, err := s.db.GetFeedsAndUserName(ctx)
 	checkError(err)
 	for _, feed := range feeds {
 		fmt.Printf("Feed: %v with URL: %v was created by: %v\n", feed.Name, feed.Url, feed.UserName)
+		if feed.LastWarning.Valid {
+			fmt.Printf("  Warning: %v\n", feed.LastWarning.String)
+		}
+		if feed.DisabledAt.Valid {
+			fmt.Printf("  Disabled after %v failed fetches\n", feed.ConsecutiveFailures)
+		}
+	}
+	return nil
+}
+
+// prints the feeds that have failed their last fetch, with how many times in a row they have failed,
+// when they will next be tried or when they were disabled, and the last error
+func listBrokenFeeds(ctx context.Context, s *state) error {
+	feeds, err := s.db.GetBrokenFeeds(ctx)
+	checkError(err)
+	if len(feeds) == 0 {
+		fmt.Println("No feeds are failing")
+		return nil
+	}
+	for _, feed := range feeds {
+		fmt.Printf("Feed: %v with URL: %v has failed %v times in a row\n", feed.Name, feed.Url, feed.ConsecutiveFailures)
+		if feed.DisabledAt.Valid {
+			fmt.Printf("  Disabled at %v\n", feed.DisabledAt.Time.Format(time.RFC1123))
+		} else if feed.NextRetryAt.Valid {
+			fmt.Printf("  Next retry at %v\n", feed.NextRetryAt.Time.Format(time.RFC1123))
+		}
+		failure, err := s.db.GetLatestFeedFailure(ctx, feed.ID)
+		if err == nil {
+			fmt.Printf("  Last error (%v): %v\n", failure.ErrorClass, failure.Message)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			checkError(err)
+		}
+	}
+	return nil
+}
+
+// takes a single feed URL and prints a summary of how fetching it has gone over the fetch history: how
+// often it succeeds, how long it takes, how often it posts and when a new item last turned up
+func handlerFeedStats(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.arguments) != 1 {
+		checkError(fmt.Errorf("1 argument expected, %v provided", len(cmd.arguments)))
+	}
+	feed, err := s.db.GetFeedsByURL(ctx, cmd.arguments[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		checkError(fmt.Errorf("there is no feed with the URL %v", cmd.arguments[0]))
+	}
+	checkError(err)
+	fetches, err := s.db.GetFeedFetches(ctx, feed.ID)
+	checkError(err)
+	postDates, err := s.db.GetRecentPostDates(ctx, database.GetRecentPostDatesParams{
+		FeedID: feed.ID,
+		Limit:  postFrequencySample,
+	})
+	checkError(err)
+	printFeedStats(os.Stdout, feed, summariseFeedStats(time.Now(), fetches, postDates), s.cfg.FetchHistoryRetention())
+	return nil
+}
+
+// takes a single feed URL and re-enables the feed if it was disabled for failing too often. Its count of
+// failures is reset so agg fetches it again on the next tick
+func handlerReenable(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.arguments) != 1 {
+		checkError(fmt.Errorf("1 argument expected, %v provided", len(cmd.arguments)))
+	}
+	feed, err := s.db.ReenableFeed(ctx, cmd.arguments[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		checkError(fmt.Errorf("there is no feed with the URL %v", cmd.arguments[0]))
 	}
+	checkError(err)
+	fmt.Printf("%v has been re-enabled and will be fetched on the next tick of agg\n", feed.Name)
 	return nil
 }
 
-// this command takes a single input, a URL and subscribes the user to the feed. If the URL does not exist
-// a new feed will not be created
-func handlerFollow(s *state, cmd command, currentUser database.User) error {
+// fetches feeds straight away rather than waiting for agg to reach them. Takes the URLs or names of the
+// feeds to fetch, or --all-followed to fetch every feed the logged in user follows, and prints how many
+// items in each were new, updated or skipped
+func handlerRefresh(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		checkError(fmt.Errorf("at least 1 feed URL or name, or --all-followed, expected"))
+	}
+	var feeds []database.Feed
+	if len(cmd.arguments) == 1 && cmd.arguments[0] == "--all-followed" {
+		currentUser, err := s.db.GetUser(ctx, s.cfg.CurrentUserName)
+		checkError(err)
+		follows, err := s.db.GetFeedsUserFollows(ctx, currentUser.ID)
+		checkError(err)
+		for _, follow := range follows {
+			feed, err := s.db.GetFeedByID(ctx, follow.FeedID)
+			checkError(err)
+			feeds = append(feeds, feed)
+		}
+	} else {
+		seen := make(map[uuid.UUID]bool)
+		for _, argument := range cmd.arguments {
+			feed, err := s.db.GetFeedsByURL(ctx, argument)
+			if errors.Is(err, sql.ErrNoRows) {
+				feed, err = s.db.GetFeedByName(ctx, argument)
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				checkError(fmt.Errorf("there is no feed with the URL or name %v", argument))
+			}
+			checkError(err)
+			if !seen[feed.ID] {
+				seen[feed.ID] = true
+				feeds = append(feeds, feed)
+			}
+		}
+	}
+	refreshFeeds(ctx, s, feeds)
+	return nil
+}
+
+// this command takes a single input, a URL and subscribes the user to the feed. If the URL is not in the
+// feeds table the feed is discovered from it, and added using the feed's own title if it is new. A feed
+// that has never been fetched is fetched straight away
+func handlerFollow(ctx context.Context, s *state, cmd command, currentUser database.User) error {
 	if len(cmd.arguments) != 1 {
 		return fmt.Errorf("1 argument expected, %v provided", len(cmd.arguments))
 	}
-	feed, err := s.db.GetFeedsByURL(context.Background(), cmd.arguments[0])
+	feed, err := s.db.GetFeedsByURL(ctx, cmd.arguments[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		feed, err = discoverAndCreateFeed(ctx, s, cmd.arguments[0], currentUser)
+	}
 	checkError(err)
-	feedFollower, err := s.db.CreateFeedFollower(context.Background(), database.CreateFeedFollowerParams{
+	feedFollower, err := s.db.CreateFeedFollower(ctx, database.CreateFeedFollowerParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -189,12 +390,13 @@ func handlerFollow(s *state, cmd command, currentUser database.User) error {
 		FeedID:    feed.ID,
 	})
 	fmt.Printf("%v is followed by %v\n", feedFollower.FeedName, feedFollower.UserName)
+	backfillFeed(ctx, s, feed)
 	return nil
 }
 
 // this command prints a list of all the feeds the user is currently following
-func handlerFollowing(s *state, cmd command, currentUser database.User) error {
-	feeds, err := s.db.GetFeedsUserFollows(context.Background(), currentUser.ID)
+func handlerFollowing(ctx context.Context, s *state, cmd command, currentUser database.User) error {
+	feeds, err := s.db.GetFeedsUserFollows(ctx, currentUser.ID)
 	checkError(err)
 	for _, feed := range feeds {
 		fmt.Println(feed.FeedName)
@@ -203,13 +405,13 @@ func handlerFollowing(s *state, cmd command, currentUser database.User) error {
 }
 
 // This command takes a single feed URL and uses it to remove the link in feed_follows for the logged in user
-func handleUnfollow(s *state, cmd command, currentUser database.User) error {
+func handleUnfollow(ctx context.Context, s *state, cmd command, currentUser database.User) error {
 	if len(cmd.arguments) != 1 {
 		return fmt.Errorf("1 argument expected, %v provided", len(cmd.arguments))
 	}
-	feed, err := s.db.GetFeedsByURL(context.Background(), cmd.arguments[0])
+	feed, err := s.db.GetFeedsByURL(ctx, cmd.arguments[0])
 	checkError(err)
-	err = s.db.DeleteFollowedFeed(context.Background(), database.DeleteFollowedFeedParams{
+	err = s.db.DeleteFollowedFeed(ctx, database.DeleteFollowedFeedParams{
 		UserID: currentUser.ID,
 		FeedID: feed.ID,
 	})
@@ -217,8 +419,9 @@ func handleUnfollow(s *state, cmd command, currentUser database.User) error {
 	return nil
 }
 
-// This command displays the subscribed feed to the user
-func handleBrowse(s *state, cmd command, currentUser database.User) error {
+// This command displays the subscribed feed to the user, after a notice for any followed feed that has
+// been disabled
+func handleBrowse(ctx context.Context, s *state, cmd command, currentUser database.User) error {
 	if len(cmd.arguments) > 1 {
 		checkError(fmt.Errorf("no more than 1 argument expected, %v provided", len(cmd.arguments)))
 	}
@@ -230,23 +433,76 @@ func handleBrowse(s *state, cmd command, currentUser database.User) error {
 	} else {
 		limit = 2
 	}
-	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
+	posts, err := s.db.GetPostsForUser(ctx, database.GetPostsForUserParams{
 		UserID: currentUser.ID,
 		Limit:  int32(limit),
 	})
 	checkError(err)
+	deadFeeds, err := s.db.GetDisabledFeedsUserFollows(ctx, currentUser.ID)
+	checkError(err)
+	for _, feed := range deadFeeds {
+		fmt.Printf("Notice: %v (%v) has stopped working and is no longer being fetched\n", feed.Name, feed.Url)
+	}
 	for _, post := range posts {
 		fmt.Println(post.Title)
+		enclosures, err := s.db.GetEnclosuresForPost(ctx, post.ID)
+		checkError(err)
+		for _, enclosure := range enclosures {
+			fmt.Printf("  %v\n", describeEnclosure(enclosure))
+		}
 	}
 	return nil
 }
 
+// downloads the podcast episodes from the feeds the user follows into the download directory from the
+// config file. It takes an optional argument for how many episodes of each feed to keep, otherwise the
+// number in the config file is used
+func handlerDownload(ctx context.Context, s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) > 1 {
+		checkError(fmt.Errorf("no more than 1 argument expected, %v provided", len(cmd.arguments)))
+	}
+	keep := s.cfg.DownloadKeep()
+	if len(cmd.arguments) == 1 {
+		var err error
+		keep, err = strconv.Atoi(cmd.arguments[0])
+		checkError(err)
+	}
+	dir, err := s.cfg.DownloadDirectory()
+	checkError(err)
+	err = downloadEpisodes(ctx, s, currentUser, dir, keep)
+	checkError(err)
+	return nil
+}
+
+// a dry run of fetching a feed. It takes a URL or the path to a local file, and optionally how many items
+// to show (defaults to 5), and prints what gator would extract from it without saving anything
+func handlerFetch(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.arguments) < 1 || len(cmd.arguments) > 2 {
+		checkError(fmt.Errorf("1 or 2 arguments expected, %v provided", len(cmd.arguments)))
+	}
+	limit := 5
+	if len(cmd.arguments) == 2 {
+		var err error
+		limit, err = strconv.Atoi(cmd.arguments[1])
+		checkError(err)
+	}
+	timeout, err := s.cfg.FetchTimeoutDuration()
+	checkError(err)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	body, contentType, err := loadFeedSource(ctx, os.Stdout, s.fetcher, cmd.arguments[0])
+	checkError(err)
+	err = printFeedPreview(os.Stdout, cmd.arguments[0], body, contentType, limit)
+	checkError(err)
+	return nil
+}
+
 // This command is to DRY up the code. There were a number of places I was getting the logged in user and this is
 // a good way to make it generic so if needed, it can be updated from a single place
-func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error {
-	return func(s *state, c command) error {
-		currentUser, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
+func middlewareLoggedIn(handler func(ctx context.Context, s *state, cmd command, user database.User) error) func(context.Context, *state, command) error {
+	return func(ctx context.Context, s *state, c command) error {
+		currentUser, err := s.db.GetUser(ctx, s.cfg.CurrentUserName)
 		checkError(err)
-		return handler(s, c, currentUser)
+		return handler(ctx, s, c, currentUser)
 	}
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// how far in the future a publication date can be before we decide the feed is wrong about it. A day
+// leaves room for feeds that get their time zone wrong
+const maxFutureSkew = 24 * time.Hour
+
+// the layouts tried by parsePubDate, in order. Day names are stripped off before parsing so the RFC822
+// style layouts don't include them
+var pubDateLayouts = []string{
+	// RFC822 and RFC1123 with four and two digit years, with and without seconds
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04:05 MST",
+	"2 January 2006 15:04 -0700",
+	"2 January 2006 15:04 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006",
+	"2 January 2006",
+	// ISO 8601, which covers Atom, JSON Feed and dc:date
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	// the formats produced by Go, C and Ruby when someone builds a feed by hand
+	time.UnixDate,
+	time.RubyDate,
+	time.ANSIC,
+}
+
+// offsets for the time zone names that turn up in feeds. time.Parse only knows the offset of a zone
+// name when it matches the local time zone, so anything else would be treated as UTC
+var zoneOffsets = map[string]int{
+	"UT":   0,
+	"UTC":  0,
+	"GMT":  0,
+	"Z":    0,
+	"EST":  -5 * 60 * 60,
+	"EDT":  -4 * 60 * 60,
+	"CST":  -6 * 60 * 60,
+	"CDT":  -5 * 60 * 60,
+	"MST":  -7 * 60 * 60,
+	"MDT":  -6 * 60 * 60,
+	"PST":  -8 * 60 * 60,
+	"PDT":  -7 * 60 * 60,
+	"AKST": -9 * 60 * 60,
+	"AKDT": -8 * 60 * 60,
+	"HST":  -10 * 60 * 60,
+	"BST":  1 * 60 * 60,
+	"IST":  5*60*60 + 30*60,
+	"WET":  0,
+	"WEST": 1 * 60 * 60,
+	"CET":  1 * 60 * 60,
+	"CEST": 2 * 60 * 60,
+	"EET":  2 * 60 * 60,
+	"EEST": 3 * 60 * 60,
+	"MSK":  3 * 60 * 60,
+	"JST":  9 * 60 * 60,
+	"KST":  9 * 60 * 60,
+	"AEST": 10 * 60 * 60,
+	"AEDT": 11 * 60 * 60,
+	"NZST": 12 * 60 * 60,
+	"NZDT": 13 * 60 * 60,
+}
+
+// matches a leading day name like "Mon, " or "Tuesday, "
+var dayNamePrefix = regexp.MustCompile(`^[A-Za-z]+,\s*`)
+
+// matches a trailing comment like "(UTC)" or "(Pacific Standard Time)"
+var zoneCommentSuffix = regexp.MustCompile(`\s*\([^)]*\)$`)
+
+// converts the publication date of an item into a time. Lots of layouts are tried since feeds are
+// rarely strict about their dates. If the date is missing or can't be parsed, or it is too far in the
+// future to be believable, firstSeen is returned along with an error explaining what went wrong
+func parsePubDate(pubDate string, firstSeen time.Time) (time.Time, error) {
+	cleaned := cleanPubDate(pubDate)
+	if cleaned == "" {
+		return firstSeen, fmt.Errorf("no publication date")
+	}
+	for _, layout := range pubDateLayouts {
+		parsed, err := time.Parse(layout, cleaned)
+		if err != nil {
+			continue
+		}
+		parsed = applyZoneOffset(parsed)
+		if parsed.After(firstSeen.Add(maxFutureSkew)) {
+			return firstSeen, fmt.Errorf("publication date %q is in the future", pubDate)
+		}
+		return parsed, nil
+	}
+	return firstSeen, fmt.Errorf("unrecognised publication date %q", pubDate)
+}
+
+// tidies up a date string so that it has a chance of matching one of the layouts
+func cleanPubDate(pubDate string) string {
+	cleaned := strings.Join(strings.Fields(pubDate), " ")
+	cleaned = dayNamePrefix.ReplaceAllString(cleaned, "")
+	cleaned = zoneCommentSuffix.ReplaceAllString(cleaned, "")
+	// time.Parse won't accept zone names shorter than three letters
+	if strings.HasSuffix(cleaned, " UT") || strings.HasSuffix(cleaned, " Z") {
+		cleaned = cleaned[:strings.LastIndex(cleaned, " ")] + " UTC"
+	}
+	return cleaned
+}
+
+// time.Parse gives unknown zone names an offset of zero, so look the name up ourselves and move the
+// time to the right offset
+func applyZoneOffset(parsed time.Time) time.Time {
+	name, offset := parsed.Zone()
+	knownOffset, ok := zoneOffsets[name]
+	if !ok || knownOffset == offset {
+		return parsed
+	}
+	return time.Date(parsed.Year(), parsed.Month(), parsed.Day(), parsed.Hour(), parsed.Minute(),
+		parsed.Second(), parsed.Nanosecond(), time.FixedZone(name, knownOffset))
+}
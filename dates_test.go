@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type testPubDateStruct struct {
+	testName  string
+	pubDate   string
+	expect    time.Time
+	expectErr bool
+}
+
+// TestParsePubDate checks the date formats that turn up in real feeds, and that the first seen time is
+// used when a date is missing, broken or in the future
+func TestParsePubDate(t *testing.T) {
+	firstSeen := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	expected := time.Date(2024, time.March, 1, 15, 4, 5, 0, time.UTC)
+	tests := []testPubDateStruct{
+		{testName: "rfc1123z", pubDate: "Fri, 01 Mar 2024 15:04:05 +0000", expect: expected},
+		{testName: "rfc1123 with gmt", pubDate: "Fri, 01 Mar 2024 15:04:05 GMT", expect: expected},
+		{testName: "named time zone", pubDate: "Fri, 01 Mar 2024 10:04:05 EST", expect: expected},
+		{testName: "rfc822 two digit year", pubDate: "01 Mar 24 15:04:05 +0000", expect: expected},
+		{testName: "missing seconds", pubDate: "Fri, 1 Mar 2024 15:04 +0000", expect: expected.Add(-5 * time.Second)},
+		{testName: "ut zone", pubDate: "Fri, 01 Mar 2024 15:04:05 UT", expect: expected},
+		{testName: "zone comment", pubDate: "Fri, 01 Mar 2024 15:04:05 +0000 (UTC)", expect: expected},
+		{testName: "full day name", pubDate: "Friday, 01 Mar 2024 15:04:05 +0000", expect: expected},
+		{testName: "iso 8601", pubDate: "2024-03-01T15:04:05Z", expect: expected},
+		{testName: "iso 8601 with offset", pubDate: "2024-03-01T16:04:05+01:00", expect: expected},
+		{testName: "iso 8601 with fraction", pubDate: "2024-03-01T15:04:05.000Z", expect: expected},
+		{testName: "iso 8601 without zone", pubDate: "2024-03-01T15:04:05", expect: expected},
+		{testName: "surrounding whitespace", pubDate: "\n   2024-03-01T15:04:05Z  \n", expect: expected},
+		{testName: "missing date", pubDate: "", expect: firstSeen, expectErr: true},
+		{testName: "nonsense", pubDate: "yesterday", expect: firstSeen, expectErr: true},
+		{testName: "far future", pubDate: "2099-01-01T00:00:00Z", expect: firstSeen, expectErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parsePubDate(test.pubDate, firstSeen)
+		if test.expectErr && err == nil {
+			t.Errorf("Error testing %v: expected an error but got nil", test.testName)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("Error testing %v: %v", test.testName, err)
+		}
+		if !got.Equal(test.expect) {
+			t.Errorf("Error testing %v: expected %v but got %v", test.testName, test.expect, got)
+		}
+	}
+}
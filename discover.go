@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+)
+
+// the paths we try when a web page doesn't advertise its feeds with <link> tags
+var fallbackFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/index.xml"}
+
+// the link types that point at a feed we know how to parse
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+	"application/json":      true,
+}
+
+// a feed found by discoverFeeds
+type discoveredFeed struct {
+	URL   string
+	Title string
+}
+
+// works out which feeds a URL points at. If the URL is already a feed it is returned as it is,
+// otherwise it is treated as a web page and searched for <link rel="alternate"> tags. If the page
+// doesn't have any, the common feed paths on the same site are tried
+func discoverFeeds(ctx context.Context, f *fetcher, pageURL string) ([]discoveredFeed, error) {
+	body, contentType, err := f.fetchURL(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	feed, err := parseFeed(body, contentType)
+	if err == nil {
+		return []discoveredFeed{{URL: pageURL, Title: feed.Channel.Title}}, nil
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	feeds := feedLinks(body, base)
+	if len(feeds) > 0 {
+		return feeds, nil
+	}
+	for _, path := range fallbackFeedPaths {
+		candidate := base.ResolveReference(&url.URL{Path: path}).String()
+		body, contentType, err := f.fetchURL(ctx, candidate)
+		if err != nil {
+			continue
+		}
+		feed, err := parseFeed(body, contentType)
+		if err != nil {
+			continue
+		}
+		feeds = append(feeds, discoveredFeed{URL: candidate, Title: feed.Channel.Title})
+	}
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("no feeds could be found at %v", pageURL)
+	}
+	return feeds, nil
+}
+
+// finds the feeds advertised in the <head> of an html page. Relative links are resolved against the
+// page URL, or the <base> element if the page has one
+func feedLinks(body []byte, base *url.URL) []discoveredFeed {
+	var feeds []discoveredFeed
+	seen := make(map[string]bool)
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return feeds
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+		token := tokenizer.Token()
+		attributes := make(map[string]string)
+		for _, attribute := range token.Attr {
+			attributes[strings.ToLower(attribute.Key)] = strings.TrimSpace(attribute.Val)
+		}
+		switch token.Data {
+		case "base":
+			if href, err := base.Parse(attributes["href"]); err == nil {
+				base = href
+			}
+		case "link":
+			if !hasRel(attributes["rel"], "alternate") {
+				continue
+			}
+			linkType := strings.ToLower(strings.TrimSpace(strings.Split(attributes["type"], ";")[0]))
+			if !feedLinkTypes[linkType] || attributes["href"] == "" {
+				continue
+			}
+			href, err := base.Parse(attributes["href"])
+			if err != nil || seen[href.String()] {
+				continue
+			}
+			seen[href.String()] = true
+			feeds = append(feeds, discoveredFeed{URL: href.String(), Title: attributes["title"]})
+		case "body":
+			return feeds
+		}
+	}
+}
+
+// rel attributes are a space separated list of link types
+func hasRel(rel string, want string) bool {
+	for _, value := range strings.Fields(strings.ToLower(rel)) {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the single feed at a URL. When discovery finds more than one the user is asked which one
+// they meant
+func chooseFeed(ctx context.Context, f *fetcher, pageURL string) (discoveredFeed, error) {
+	feeds, err := discoverFeeds(ctx, f, pageURL)
+	if err != nil {
+		return discoveredFeed{}, err
+	}
+	if len(feeds) == 1 {
+		return feeds[0], nil
+	}
+	fmt.Printf("%v feeds were found at %v:\n", len(feeds), pageURL)
+	for x, feed := range feeds {
+		fmt.Printf("%v) %v %v\n", x+1, feed.URL, feed.Title)
+	}
+	fmt.Print("Which feed do you want? ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return discoveredFeed{}, err
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || choice < 1 || choice > len(feeds) {
+		return discoveredFeed{}, fmt.Errorf("%q is not one of the listed feeds", strings.TrimSpace(answer))
+	}
+	return feeds[choice-1], nil
+}
+
+// discovers the feed at a URL and returns its row in the feeds table, creating the row if nobody has
+// added the feed yet. New feeds are named after their title, or their URL if they don't have one, made
+// unique by uniqueFeedName
+func discoverAndCreateFeed(ctx context.Context, s *state, pageURL string, currentUser database.User) (database.Feed, error) {
+	discovered, err := chooseFeed(ctx, s.fetcher, pageURL)
+	if err != nil {
+		return database.Feed{}, err
+	}
+	feed, err := s.db.GetFeedsByURL(ctx, discovered.URL)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return feed, err
+	}
+	name, err := uniqueFeedName(ctx, s, discovered.Title, discovered.URL)
+	if err != nil {
+		return database.Feed{}, err
+	}
+	feed, err = s.db.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      name,
+		Url:       discovered.URL,
+		UserID:    currentUser.ID,
+	})
+	if err != nil {
+		return database.Feed{}, err
+	}
+	fmt.Printf("New feed %v added from %v\n", feed.Name, feed.Url)
+	return feed, nil
+}
+
+// the longest name the feeds table can hold
+const maxFeedNameLength = 255
+
+// picks a name for a discovered feed that no other feed has. The title is used if it is free, otherwise
+// the feed's host is added to it, then a number
+func uniqueFeedName(ctx context.Context, s *state, title string, feedURL string) (string, error) {
+	name := strings.TrimSpace(title)
+	if name == "" {
+		name = feedURL
+	}
+	host := feedURL
+	if parsed, err := url.Parse(feedURL); err == nil && parsed.Host != "" {
+		host = parsed.Hostname()
+	}
+	for attempt := 1; ; attempt++ {
+		candidate := feedNameCandidate(name, host, attempt)
+		_, err := s.db.GetFeedByName(ctx, candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// returns the name to try for a feed on the given attempt: the name itself, then with the host, then with
+// the host and a number. Long names are cut short so the whole thing fits in the name column
+func feedNameCandidate(name string, host string, attempt int) string {
+	suffix := ""
+	if attempt == 2 {
+		suffix = fmt.Sprintf(" (%v)", host)
+	} else if attempt > 2 {
+		suffix = fmt.Sprintf(" (%v %v)", host, attempt-1)
+	}
+	runes := []rune(name)
+	limit := max(maxFeedNameLength-utf8.RuneCountInString(suffix), 1)
+	if len(runes) > limit {
+		runes = runes[:limit]
+	}
+	candidate := []rune(strings.TrimSpace(string(runes)) + suffix)
+	if len(candidate) > maxFeedNameLength {
+		candidate = candidate[:maxFeedNameLength]
+	}
+	return string(candidate)
+}
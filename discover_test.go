@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFeedLinks checks that feeds advertised in a page's head are found and resolved
+func TestFeedLinks(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><title>Blog</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="RSS" href="/rss.xml">
+<link rel="Alternate" type="application/atom+xml; charset=utf-8" title="Atom" href="https://example.com/atom.xml"/>
+<link rel="alternate" type="application/feed+json" href="feed.json">
+<link rel="alternate" type="text/html" hreflang="fr" href="/fr/">
+</head><body><link rel="alternate" type="application/rss+xml" href="/comments.xml"></body></html>`
+	base, _ := url.Parse("https://example.com/blog/")
+	expect := []discoveredFeed{
+		{URL: "https://example.com/rss.xml", Title: "RSS"},
+		{URL: "https://example.com/atom.xml", Title: "Atom"},
+		{URL: "https://example.com/blog/feed.json"},
+	}
+
+	got := feedLinks([]byte(page), base)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Error testing feed links: expected %v but got %v", expect, got)
+	}
+}
+
+// TestDiscoverFeedsFallback checks that the common feed paths are tried when a page has no feed links
+func TestDiscoverFeedsFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`<html><head><title>Blog</title></head><body></body></html>`))
+	})
+	mux.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss version="2.0"><channel><title>Blog</title></channel></rss>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	expect := []discoveredFeed{{URL: server.URL + "/index.xml", Title: "Blog"}}
+
+	got, err := discoverFeeds(context.Background(), testFetcher(t), server.URL+"/")
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Error testing fallback discovery: expected %v but got %v", expect, got)
+	}
+}
+
+// TestFeedNameCandidate checks the names tried for a discovered feed fit the name column and get more
+// specific on each attempt
+func TestFeedNameCandidate(t *testing.T) {
+	long := strings.Repeat("é", 300)
+	cases := []struct {
+		testName string
+		name     string
+		attempt  int
+		expect   string
+	}{
+		{testName: "first attempt", name: "Blog", attempt: 1, expect: "Blog"},
+		{testName: "with host", name: "Blog", attempt: 2, expect: "Blog (example.com)"},
+		{testName: "with number", name: "Blog", attempt: 4, expect: "Blog (example.com 3)"},
+		{testName: "long title", name: long, attempt: 1, expect: strings.Repeat("é", 255)},
+		{testName: "long title with host", name: long, attempt: 2, expect: strings.Repeat("é", 241) + " (example.com)"},
+	}
+	for _, c := range cases {
+		actual := feedNameCandidate(c.name, "example.com", c.attempt)
+		if actual != c.expect {
+			t.Errorf("Error testing %v: expected %v but got %v", c.testName, c.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+)
+
+// characters we don't want in file and directory names
+var unsafeFileNameCharacters = regexp.MustCompile(`[^A-Za-z0-9 ._-]+`)
+
+// downloads the episodes of the feeds a user follows. The most recent keep episodes of each feed are
+// downloaded if they aren't on disk already, and older episodes are deleted
+func downloadEpisodes(ctx context.Context, s *state, currentUser database.User, dir string, keep int) error {
+	enclosures, err := s.db.GetFollowedPodcastEnclosures(ctx, currentUser.ID)
+	if err != nil {
+		return err
+	}
+	downloaded, failed, removed := 0, 0, 0
+	for _, enclosure := range enclosures {
+		filePath := enclosurePath(dir, enclosure)
+		if enclosure.FeedRank > int64(keep) {
+			if removeDownload(filePath) {
+				removed++
+			}
+			continue
+		}
+		if _, err := os.Stat(filePath); err == nil {
+			continue
+		}
+		fmt.Printf("Downloading %v from %v\n", enclosure.PostTitle, enclosure.FeedName)
+		err = s.fetcher.downloadFile(ctx, enclosure.Url, filePath)
+		if err != nil {
+			fmt.Printf("Could not download %v: %v\n", enclosure.Url, err)
+			failed++
+			continue
+		}
+		downloaded++
+	}
+	fmt.Printf("%v episodes downloaded, %v failed and %v old episodes removed from %v\n", downloaded, failed, removed, dir)
+	return nil
+}
+
+// works out where an episode is saved. Each feed gets its own directory, and the file name starts with
+// the date it was published so the episodes sort in order
+func enclosurePath(dir string, enclosure database.GetFollowedPodcastEnclosuresRow) string {
+	fileName := enclosure.ID.String()
+	parsed, err := url.Parse(enclosure.Url)
+	if err == nil {
+		base := path.Base(parsed.Path)
+		if base != "/" && base != "." {
+			fileName = base
+		}
+	}
+	return filepath.Join(dir, safeFileName(enclosure.FeedName),
+		enclosure.PublishedAt.Format("2006-01-02")+" "+safeFileName(fileName))
+}
+
+// replaces anything that might cause trouble in a file name
+func safeFileName(name string) string {
+	safe := strings.Trim(unsafeFileNameCharacters.ReplaceAllString(name, "_"), " .")
+	if len(safe) > 100 {
+		safe = safe[:100]
+	}
+	if safe == "" {
+		safe = "_"
+	}
+	return safe
+}
+
+// deletes a downloaded episode along with any partial download. Returns true if there was a file to
+// delete
+func removeDownload(filePath string) bool {
+	removed := os.Remove(filePath) == nil
+	os.Remove(filePath + ".part")
+	return removed
+}
+
+// downloads a file to the given path. The file is written to a .part file first and renamed once it is
+// complete, so if a download is interrupted it is resumed from where it stopped the next time. Episode
+// URLs come from feeds, so they are checked against the URL policy the same as feed URLs are
+func (f *fetcher) downloadFile(ctx context.Context, fileURL string, filePath string) error {
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return err
+	}
+	partPath := filePath + ".part"
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return err
+	}
+	err = f.policy.checkURL(request.Context(), request.URL)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("User-Agent", f.userAgent)
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := f.downloads.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		_, err = file.Seek(offset, io.SeekStart)
+	case http.StatusOK:
+		// the server ignored the range so start again from the beginning
+		err = file.Truncate(0)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file is already complete
+		file.Close()
+		return os.Rename(partPath, filePath)
+	default:
+		return fmt.Errorf("unexpected status %v", response.Status)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, response.Body)
+	if err != nil {
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(partPath, filePath)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDownloadFileResume checks that a partial download is finished rather than started again
+func TestDownloadFileResume(t *testing.T) {
+	episode := []byte(strings.Repeat("episode audio ", 1000))
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "episode.mp3", time.Time{}, bytes.NewReader(episode))
+	}))
+	defer server.Close()
+	filePath := filepath.Join(t.TempDir(), "feed", "episode.mp3")
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filePath+".part", episode[:500], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testFetcher(t).downloadFile(context.Background(), server.URL+"/episode.mp3", filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, episode) {
+		t.Errorf("Error testing resume: expected %v bytes but got %v", len(episode), len(got))
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=500-" {
+		t.Errorf("Error testing resume: expected a request for bytes=500- but got %v", ranges)
+	}
+	if _, err := os.Stat(filePath + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Error testing resume: expected the .part file to be removed")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// byte order marks that can appear at the start of a feed
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+)
+
+// creates an xml decoder that can read feeds that aren't UTF-8. The encoding comes from, in order of
+// preference, a UTF-16 byte order mark, the charset in the HTTP Content-Type header, and the encoding in
+// the XML declaration. When the encoding is already known from the first two the body is converted up
+// front and the declaration is ignored, otherwise it is left to the decoder's CharsetReader. Lenient
+// decoders accept html entities, unclosed html tags and stray ampersands
+func newFeedDecoder(body []byte, contentType string, lenient bool) *xml.Decoder {
+	var reader io.Reader = bytes.NewReader(body)
+	label := ""
+	switch {
+	case bytes.HasPrefix(body, utf16BEBOM):
+		label = "utf-16be"
+		reader = bytes.NewReader(body[len(utf16BEBOM):])
+	case bytes.HasPrefix(body, utf16LEBOM):
+		label = "utf-16le"
+		reader = bytes.NewReader(body[len(utf16LEBOM):])
+	default:
+		label = contentTypeCharset(contentType)
+	}
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+	if label != "" && !isUTF8(label) {
+		converted, err := charset.NewReaderLabel(label, reader)
+		if err == nil {
+			decoder = xml.NewDecoder(converted)
+			decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+				return input, nil
+			}
+		}
+	}
+	if lenient {
+		decoder.Strict = false
+		decoder.AutoClose = xml.HTMLAutoClose
+		decoder.Entity = xml.HTMLEntity
+	}
+	return decoder
+}
+
+// returns the charset parameter of a Content-Type header, if it has one
+func contentTypeCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(params["charset"])
+}
+
+// reports whether an encoding label means UTF-8, or a subset of it
+func isUTF8(label string) bool {
+	switch strings.ToLower(label) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// errors that say why a feed couldn't be fetched, so failures can be grouped into classes
+var (
+	errRobotsDisallowed = errors.New("disallowed by robots.txt")
+	errHostBackoff      = errors.New("host asked us to back off")
+	errFeedParse        = errors.New("could not parse feed")
+	errSavePosts        = errors.New("could not save posts")
+	errResponseTooLarge = errors.New("response too large")
+	errBlockedURL       = errors.New("URL not allowed")
+)
+
+// the longest a failing feed is left before it is retried, unless the agg interval is longer
+const maxRetryBackoff = 24 * time.Hour
+
+// the Postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// returned when a server responds with a status other than 2xx or 304
+type httpStatusError struct {
+	statusCode int
+	status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected response %v", e.status)
+}
+
+// returned when we hold off from a request to be polite, because the host asked us to back off or its
+// robots.txt doesn't allow it. reason is errHostBackoff or errRobotsDisallowed, and until is when we can
+// ask again. These aren't the feed's fault, so they don't count towards disabling it
+type waitError struct {
+	reason  error
+	until   time.Time
+	message string
+}
+
+func (e *waitError) Error() string {
+	return fmt.Sprintf("%v: %v", e.reason, e.message)
+}
+
+func (e *waitError) Unwrap() error {
+	return e.reason
+}
+
+// sorts an error from scraping a feed into a class, and returns the HTTP status code if there was one
+func classifyError(err error) (string, int) {
+	var statusErr *httpStatusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &statusErr):
+		if statusErr.statusCode == 429 {
+			return "rate_limited", statusErr.statusCode
+		}
+		return "http_status", statusErr.statusCode
+	case errors.Is(err, errHostBackoff):
+		return "rate_limited", 0
+	case errors.Is(err, errRobotsDisallowed):
+		return "robots", 0
+	case errors.Is(err, errBlockedURL):
+		return "blocked", 0
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout", 0
+	case errors.As(err, &dnsErr):
+		return "dns", 0
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout", 0
+	case errors.As(err, &netErr):
+		return "network", 0
+	case errors.Is(err, errFeedParse):
+		return "parse", 0
+	case errors.Is(err, errResponseTooLarge):
+		return "too_large", 0
+	case errors.Is(err, errSavePosts), errors.As(err, &pqErr):
+		return "database", 0
+	default:
+		return "other", 0
+	}
+}
+
+// reports whether an error from inserting a row was caused by the row already existing
+func isDuplicate(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// prints a scrape failure and records it against the feed in the feed_failures table. The feed's count of
+// failures in a row goes up and it is left until its backoff has passed, or disabled if it has failed
+// too many times in a row. A fetch we held off from to be polite to the host is recorded too, but the
+// feed is only left until the host can be asked again and its count of failures doesn't change
+func recordFailure(ctx context.Context, s *state, feed database.Feed, err error, interval time.Duration) {
+	class := createFeedFailure(ctx, s, feed, err)
+	retryAt, counted := failureRetry(err, interval, feed.ConsecutiveFailures+1, time.Now())
+	if !counted {
+		fmt.Printf("Not fetching %v yet (%v): %v\n", feed.Name, class, err)
+		dbErr := s.db.DeferFeed(ctx, database.DeferFeedParams{
+			ID:          feed.ID,
+			NextRetryAt: sql.NullTime{Time: retryAt, Valid: true},
+		})
+		if dbErr != nil {
+			fmt.Printf("Could not put off %v: %v\n", feed.Name, dbErr)
+		}
+		return
+	}
+	fmt.Printf("Could not fetch %v (%v): %v\n", feed.Name, class, err)
+	updated, dbErr := s.db.MarkFeedFailed(ctx, database.MarkFeedFailedParams{
+		RetryAt:      retryAt,
+		DisableAfter: int32(s.cfg.DisableAfterFailures()),
+		ID:           feed.ID,
+	})
+	if dbErr != nil {
+		fmt.Printf("Could not mark %v as failed: %v\n", feed.Name, dbErr)
+		return
+	}
+	if updated.DisabledAt.Valid {
+		fmt.Printf("%v has failed %v times in a row and has been disabled, use reenable %v to try it again\n", feed.Name, updated.ConsecutiveFailures, feed.Url)
+	}
+}
+
+// prints and records posts from a feed that couldn't be saved. Unlike recordFailure this doesn't count
+// towards disabling the feed, since the rest of it was fetched and saved
+func recordSaveFailure(ctx context.Context, s *state, feed database.Feed, err error) {
+	fmt.Printf("Could not save all of %v: %v\n", feed.Name, err)
+	createFeedFailure(ctx, s, feed, err)
+}
+
+// adds a failure to the feed_failures table and returns its class
+func createFeedFailure(ctx context.Context, s *state, feed database.Feed, err error) string {
+	class, statusCode := classifyError(err)
+	dbErr := s.db.CreateFeedFailure(ctx, database.CreateFeedFailureParams{
+		ID:         uuid.New(),
+		CreatedAt:  time.Now(),
+		FeedID:     feed.ID,
+		StatusCode: sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+		ErrorClass: class,
+		Message:    err.Error(),
+	})
+	if dbErr != nil {
+		fmt.Printf("Could not record the failure for %v: %v\n", feed.Name, dbErr)
+	}
+	return class
+}
+
+// works out when to retry a feed after a failed fetch, and whether the failure counts towards disabling
+// it. failures is the number of failures in a row including this one. A fetch we held off from to be
+// polite is retried once the host can be asked again and doesn't count, anything else is retried on
+// retryBackoff
+func failureRetry(err error, interval time.Duration, failures int32, now time.Time) (time.Time, bool) {
+	var wait *waitError
+	if errors.As(err, &wait) {
+		return wait.until, false
+	}
+	return now.Add(retryBackoff(interval, failures)), true
+}
+
+// returns how long to wait before retrying a feed that has failed the given number of times in a row. The
+// wait starts at the agg interval and doubles with each failure, up to maxRetryBackoff
+func retryBackoff(interval time.Duration, failures int32) time.Duration {
+	backoff := interval
+	for i := int32(1); i < failures && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff && interval <= maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
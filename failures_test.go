@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TestClassifyError checks that the errors from fetching a feed end up in the right class
+func TestClassifyError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/busy", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("this is not a feed"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// the 429 goes last because it makes the fetcher back off from the test server
+	f := testFetcher(t)
+	cases := []struct {
+		testName   string
+		path       string
+		class      string
+		statusCode int
+	}{
+		{testName: "not found", path: "/missing", class: "http_status", statusCode: 404},
+		{testName: "not a feed", path: "/broken", class: "parse"},
+		{testName: "too many requests", path: "/busy", class: "rate_limited", statusCode: 429},
+	}
+	for _, c := range cases {
+		_, _, err := f.fetchFeed(context.Background(), server.URL+c.path, feedCache{})
+		if err == nil {
+			t.Errorf("Error testing %v: expected an error", c.testName)
+			continue
+		}
+		class, statusCode := classifyError(err)
+		if class != c.class || statusCode != c.statusCode {
+			t.Errorf("Error testing %v: expected %v %v but got %v %v", c.testName, c.class, c.statusCode, class, statusCode)
+		}
+	}
+
+	duplicate := &pq.Error{Code: uniqueViolation}
+	if !isDuplicate(duplicate) {
+		t.Errorf("Error testing duplicate: expected %v to be a duplicate", duplicate)
+	}
+	if isDuplicate(errors.New("connection refused")) {
+		t.Errorf("Error testing duplicate: expected a plain error not to be a duplicate")
+	}
+}
+
+// TestRetryBackoff checks that the wait before retrying a failing feed doubles with each failure and is capped
+func TestRetryBackoff(t *testing.T) {
+	cases := []struct {
+		testName string
+		interval time.Duration
+		failures int32
+		expect   time.Duration
+	}{
+		{testName: "first failure", interval: time.Hour, failures: 1, expect: time.Hour},
+		{testName: "third failure", interval: time.Hour, failures: 3, expect: 4 * time.Hour},
+		{testName: "capped", interval: time.Hour, failures: 20, expect: maxRetryBackoff},
+		{testName: "long interval", interval: 48 * time.Hour, failures: 3, expect: 48 * time.Hour},
+	}
+	for _, c := range cases {
+		got := retryBackoff(c.interval, c.failures)
+		if got != c.expect {
+			t.Errorf("Error testing %v: expected %v but got %v", c.testName, c.expect, got)
+		}
+	}
+}
+
+// TestBackedOffFeedNotDisabled checks that a feed whose host keeps asking us to back off is retried once
+// the host can be asked again, and that however often it happens the feed is never disabled
+func TestBackedOffFeedNotDisabled(t *testing.T) {
+	hosts := newHostLimiter(time.Millisecond, 1)
+	hosts.backoff("example.com", maxRetryAfter)
+	_, err := hosts.acquire(context.Background(), "example.com")
+	if !errors.Is(err, errHostBackoff) {
+		t.Fatalf("Error testing backoff: expected a backoff error but got %v", err)
+	}
+	now := time.Now()
+	var failures int32
+	for range 100 {
+		retryAt, counted := failureRetry(err, time.Minute, failures+1, now)
+		if counted {
+			failures++
+		}
+		if retryAt.Before(now.Add(maxRetryAfter - time.Minute)) {
+			t.Fatalf("Error testing backoff: expected a retry once the backoff is over but got %v", retryAt)
+		}
+	}
+	if failures != 0 {
+		t.Errorf("Error testing backoff: expected 0 failures but got %v", failures)
+	}
+
+	retryAt, counted := failureRetry(errors.New("connection refused"), time.Minute, 1, now)
+	if !counted || !retryAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Error testing other failure: expected a counted retry at %v but got %v %v", now.Add(time.Minute), counted, retryAt)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/config"
+)
+
+// the fetcher makes all the HTTP requests for feeds. It is shared by everything running in the process
+// so that the limits it keeps for each host apply across all of the agg workers
+type fetcher struct {
+	client *http.Client
+	// used for podcast downloads, which share the client's transport but can take as long as they need
+	downloads    *http.Client
+	userAgent    string
+	maxBodyBytes int64
+	hosts        *hostLimiter
+	policy       *urlPolicy
+}
+
+// the TLS versions that can be set as tls_min_version. 1.2 is used when it isn't set
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// creates a fetcher using the settings in the config file
+func newFetcher(cfg config.Config) (*fetcher, error) {
+	spacing, err := cfg.HostSpacingDuration()
+	if err != nil {
+		return nil, err
+	}
+	policy := newURLPolicy(cfg.AllowedHosts, cfg.ProxyURL)
+	transport, err := newTransport(cfg, policy)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := cfg.RequestTimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	checkRedirect := func(request *http.Request, via []*http.Request) error {
+		err := policy.checkURL(request.Context(), request.URL)
+		if err != nil {
+			return err
+		}
+		return trackRedirects(request, via)
+	}
+	return &fetcher{
+		client: &http.Client{
+			Transport:     transport,
+			Timeout:       timeout,
+			CheckRedirect: checkRedirect,
+		},
+		downloads: &http.Client{
+			Transport:     transport,
+			CheckRedirect: checkRedirect,
+		},
+		userAgent:    cfg.UserAgentString(),
+		maxBodyBytes: cfg.MaxBodySize(),
+		hosts:        newHostLimiter(spacing, cfg.HostConcurrencyLimit()),
+		policy:       policy,
+	}, nil
+}
+
+// builds the transport used for every request from the timeouts, proxy and TLS settings in the config
+// file. Without a proxy_url the usual HTTP_PROXY and HTTPS_PROXY environment variables are used, and a
+// ca_bundle is trusted as well as the system's certificates rather than instead of them. Every connection
+// is checked against the URL policy once its address is resolved
+func newTransport(cfg config.Config, policy *urlPolicy) (*http.Transport, error) {
+	connectTimeout, err := cfg.ConnectTimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	responseTimeout, err := cfg.ResponseTimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSMinVersion != "" {
+		version, ok := tlsVersions[cfg.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls_min_version must be 1.2 or 1.3, not %q", cfg.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read ca_bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_bundle %v", cfg.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           policy.dialContext(dialer),
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: responseTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}, nil
+}
+
+// the details used to avoid downloading and parsing a feed that hasn't changed. The ETag and
+// Last-Modified headers are sent back to the server on the next fetch, and the hash of the body catches
+// servers that don't support conditional requests
+type feedCache struct {
+	ETag         string
+	LastModified string
+	ContentHash  string
+	// when the server's Cache-Control or Expires header says the feed will be stale. This isn't saved, it
+	// is only used to schedule the next fetch
+	FreshUntil time.Time
+	// where the feed was permanently or temporarily redirected to, if it was. These aren't saved either
+	MovedTo      string
+	RedirectedTo string
+	// the status of the response and the size of its body, for the fetch history
+	StatusCode int
+	Bytes      int
+}
+
+// fetches a feed from a given URL. If the server says the feed hasn't changed since the details in
+// previous were saved, or the body is the same as last time, the returned feed is nil. The returned
+// cache should be saved for the next fetch either way
+func (f *fetcher) fetchFeed(ctx context.Context, feedURL string, previous feedCache) (*RSSFeed, feedCache, error) {
+	response, err := f.fetchConditional(ctx, feedURL, previous)
+	if err != nil {
+		return nil, previous, err
+	}
+	cache := feedCache{
+		ETag:         response.etag,
+		LastModified: response.lastModified,
+		ContentHash:  previous.ContentHash,
+		FreshUntil:   response.freshUntil,
+		MovedTo:      response.movedTo,
+		RedirectedTo: response.redirectedTo,
+		StatusCode:   response.statusCode,
+		Bytes:        len(response.body),
+	}
+	if response.notModified {
+		if cache.ETag == "" {
+			cache.ETag = previous.ETag
+		}
+		if cache.LastModified == "" {
+			cache.LastModified = previous.LastModified
+		}
+		return nil, cache, nil
+	}
+	hash := sha256.Sum256(response.body)
+	cache.ContentHash = hex.EncodeToString(hash[:])
+	if cache.ContentHash == previous.ContentHash {
+		return nil, cache, nil
+	}
+	feed, err := parseFetchedFeed(response.body, response.contentType)
+	if err != nil {
+		return nil, previous, err
+	}
+	return feed, cache, nil
+}
+
+// parses a feed that has come over HTTP, whether it was fetched or pushed, and unescapes the titles and
+// descriptions that servers often escape twice
+func parseFetchedFeed(body []byte, contentType string) (*RSSFeed, error) {
+	feed, err := parseFeed(body, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errFeedParse, err)
+	}
+	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
+	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
+
+	for x, rssItem := range feed.Channel.Item {
+		rssItem.Title = html.UnescapeString(rssItem.Title)
+		rssItem.Description = html.UnescapeString(rssItem.Description)
+		feed.Channel.Item[x] = rssItem
+	}
+	return feed, nil
+}
+
+// the parts of an HTTP response we need once the body has been read
+type fetchResponse struct {
+	statusCode   int
+	body         []byte
+	contentType  string
+	notModified  bool
+	etag         string
+	lastModified string
+	freshUntil   time.Time
+	movedTo      string
+	redirectedTo string
+}
+
+// requests a URL and returns the body of the response along with its content type
+func (f *fetcher) fetchURL(ctx context.Context, pageURL string) ([]byte, string, error) {
+	response, err := f.fetchConditional(ctx, pageURL, feedCache{})
+	if err != nil {
+		return nil, "", err
+	}
+	return response.body, response.contentType, nil
+}
+
+// requests a URL, sending If-None-Match and If-Modified-Since when the cache has an ETag or
+// Last-Modified from a previous request. A 304 Not Modified response is returned with notModified set
+// and no body, any other status outside 2xx is an error, and so is a body bigger than max_body_bytes.
+// Requests are spaced out and limited per host, and are refused if the host's robots.txt doesn't allow
+// them or the host has told us to back off. URLs the policy doesn't allow are refused, here and on every
+// redirect. Redirects are followed, and where they led is returned so moved feeds can be updated
+func (f *fetcher) fetchConditional(ctx context.Context, pageURL string, cache feedCache) (fetchResponse, error) {
+	redirects := &redirectTracker{}
+	request, err := http.NewRequestWithContext(context.WithValue(ctx, redirectTrackerKey{}, redirects), http.MethodGet, pageURL, nil)
+	if err != nil {
+		return fetchResponse{}, err
+	}
+	err = f.policy.checkURL(request.Context(), request.URL)
+	if err != nil {
+		return fetchResponse{}, err
+	}
+	request.Header.Set("User-Agent", f.userAgent)
+	if cache.ETag != "" {
+		request.Header.Set("If-None-Match", cache.ETag)
+	}
+	if cache.LastModified != "" {
+		request.Header.Set("If-Modified-Since", cache.LastModified)
+	}
+	release, err := f.hosts.acquire(ctx, request.URL.Host)
+	if err != nil {
+		return fetchResponse{}, err
+	}
+	defer release()
+	err = f.checkRobots(ctx, request.URL)
+	if err != nil {
+		return fetchResponse{}, err
+	}
+	response, err := f.client.Do(request)
+	if err != nil {
+		return fetchResponse{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		wait := parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+		f.hosts.backoff(request.URL.Host, wait)
+		return fetchResponse{}, fmt.Errorf("%w, not fetching from %v again for %v", &httpStatusError{statusCode: response.StatusCode, status: response.Status}, request.URL.Host, wait)
+	}
+	result := fetchResponse{
+		statusCode:   response.StatusCode,
+		contentType:  response.Header.Get("Content-Type"),
+		notModified:  response.StatusCode == http.StatusNotModified,
+		etag:         response.Header.Get("ETag"),
+		lastModified: response.Header.Get("Last-Modified"),
+		freshUntil:   parseFreshness(response.Header, time.Now()),
+		movedTo:      redirects.movedTo,
+		redirectedTo: redirects.redirectedTo,
+	}
+	if result.notModified {
+		return result, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fetchResponse{}, &httpStatusError{statusCode: response.StatusCode, status: response.Status}
+	}
+	if response.ContentLength > f.maxBodyBytes {
+		return fetchResponse{}, fmt.Errorf("%w: %v is %v bytes, the limit is %v", errResponseTooLarge, pageURL, response.ContentLength, f.maxBodyBytes)
+	}
+	result.body, err = io.ReadAll(io.LimitReader(response.Body, f.maxBodyBytes+1))
+	if err != nil {
+		return fetchResponse{}, err
+	}
+	if int64(len(result.body)) > f.maxBodyBytes {
+		return fetchResponse{}, fmt.Errorf("%w: %v is more than the limit of %v bytes", errResponseTooLarge, pageURL, f.maxBodyBytes)
+	}
+	return result, nil
+}
+
+// works out when a response goes stale from its Cache-Control max-age, less its Age, or failing that its
+// Expires header. Returns the zero time if the response has neither or mustn't be cached
+func parseFreshness(header http.Header, now time.Time) time.Time {
+	maxAge := -1
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return time.Time{}
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err == nil {
+				maxAge = seconds
+			}
+		}
+	}
+	if maxAge >= 0 {
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return now.Add(time.Duration(maxAge-age) * time.Second)
+	}
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return time.Time{}
+	}
+	return expires
+}
+
+// the most redirects followed for a single request
+const maxRedirects = 10
+
+// the key a request's redirectTracker is stored under in its context
+type redirectTrackerKey struct{}
+
+// records where a request was redirected. movedTo is the last URL reached through nothing but permanent
+// redirects, and redirectedTo is where the request ended up once a temporary redirect was followed
+type redirectTracker struct {
+	movedTo      string
+	redirectedTo string
+}
+
+// used as the client's CheckRedirect so every redirect is recorded in the tracker in the request's context
+func trackRedirects(request *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %v redirects", maxRedirects)
+	}
+	redirects, ok := request.Context().Value(redirectTrackerKey{}).(*redirectTracker)
+	if !ok || request.Response == nil {
+		return nil
+	}
+	status := request.Response.StatusCode
+	permanent := status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+	if permanent && redirects.redirectedTo == "" {
+		redirects.movedTo = request.URL.String()
+	} else {
+		redirects.redirectedTo = request.URL.String()
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/config"
+)
+
+// creates a fetcher that doesn't wait long between requests so the tests run quickly, and that is allowed
+// to fetch from the test servers on the loopback address
+func testFetcher(t *testing.T) *fetcher {
+	f, err := newFetcher(config.Config{HostSpacing: "1ms", AllowedHosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// TestFetchFeedConditional checks that unchanged feeds are skipped, both when the server supports
+// conditional requests and when it doesn't
+func TestFetchFeedConditional(t *testing.T) {
+	body := `<rss><channel><title>Blog</title><item><title>Hello</title></item></channel></rss>`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := testFetcher(t)
+	for _, path := range []string{"/etag", "/plain"} {
+		feed, cache, err := f.fetchFeed(context.Background(), server.URL+path, feedCache{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if feed == nil || len(feed.Channel.Item) != 1 {
+			t.Errorf("Error testing %v: expected the first fetch to return the feed", path)
+		}
+		feed, _, err = f.fetchFeed(context.Background(), server.URL+path, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if feed != nil {
+			t.Errorf("Error testing %v: expected the second fetch to be skipped", path)
+		}
+	}
+}
+
+// TestFetchRobots checks that paths disallowed for gator in robots.txt aren't fetched
+func TestFetchRobots(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /\n\nUser-agent: gator\nDisallow: /private/\n"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss><channel><title>Blog</title></channel></rss>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	f := testFetcher(t)
+
+	_, _, err := f.fetchURL(context.Background(), server.URL+"/feed.xml")
+	if err != nil {
+		t.Errorf("Error testing allowed path: %v", err)
+	}
+	_, _, err = f.fetchURL(context.Background(), server.URL+"/private/feed.xml")
+	if err == nil || !strings.Contains(err.Error(), "robots.txt") {
+		t.Errorf("Error testing disallowed path: expected a robots.txt error but got %v", err)
+	}
+}
+
+// TestFetchRobotsServerError checks that nothing is fetched from a host whose robots.txt errors
+func TestFetchRobotsServerError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		requests++
+		w.Write([]byte(`<rss><channel><title>Blog</title></channel></rss>`))
+	}))
+	defer server.Close()
+	f := testFetcher(t)
+
+	_, _, err := f.fetchURL(context.Background(), server.URL+"/feed.xml")
+	if err == nil || !strings.Contains(err.Error(), "robots.txt") {
+		t.Errorf("Error testing robots.txt server error: expected a robots.txt error but got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Error testing robots.txt server error: expected 0 requests but got %v", requests)
+	}
+}
+
+// TestFetchRetryAfter checks that a host that responds 429 isn't asked again until Retry-After has passed
+func TestFetchRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	f := testFetcher(t)
+
+	for range 2 {
+		_, _, err := f.fetchURL(context.Background(), server.URL+"/feed.xml")
+		if err == nil {
+			t.Errorf("Error testing retry after: expected an error but got nil")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Error testing retry after: expected 1 request but got %v", requests)
+	}
+}
+
+// TestHostLimiterSpacing checks that requests to the same host are spaced out but other hosts aren't held up
+func TestHostLimiterSpacing(t *testing.T) {
+	limiter := newHostLimiter(50*time.Millisecond, 2)
+	start := time.Now()
+	for _, host := range []string{"a.example.com", "b.example.com", "a.example.com"} {
+		release, err := limiter.acquire(context.Background(), host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	elapsed := time.Since(start)
+	if elapsed < 50*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("Error testing spacing: expected to wait about 50ms but waited %v", elapsed)
+	}
+}
+
+// TestHostLimiterSetLimits checks that changing the limits keeps a host's backoff and robots.txt
+func TestHostLimiterSetLimits(t *testing.T) {
+	limiter := newHostLimiter(time.Second, 1)
+	limiter.backoff("a.example.com", time.Hour)
+	limiter.cacheRobots("a.example.com", robotsRules{crawlDelay: time.Second}, time.Now().Add(time.Hour))
+	limiter.setLimits(time.Millisecond, 3)
+
+	_, err := limiter.acquire(context.Background(), "a.example.com")
+	if !errors.Is(err, errHostBackoff) {
+		t.Errorf("Error testing backoff: expected a backoff error but got %v", err)
+	}
+	_, _, ok := limiter.cachedRobots("a.example.com")
+	if !ok {
+		t.Errorf("Error testing robots.txt: expected the rules to still be cached")
+	}
+	for range 3 {
+		_, err := limiter.acquire(context.Background(), "b.example.com")
+		if err != nil {
+			t.Fatalf("Error testing concurrency: expected 3 requests at once but got %v", err)
+		}
+	}
+}
+
+// TestParseRetryAfter checks both forms of the Retry-After header
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"Fri, 01 Mar 2024 12:10:00 GMT": 10 * time.Minute,
+		"":                              defaultRetryAfter,
+		"999999999":                     maxRetryAfter,
+	}
+	for header, expect := range tests {
+		got := parseRetryAfter(header, now)
+		if got != expect {
+			t.Errorf("Error testing %q: expected %v but got %v", header, expect, got)
+		}
+	}
+}
+
+// TestRobotsRules checks group selection, longest match and wildcards
+func TestRobotsRules(t *testing.T) {
+	robots := []byte(`# comment
+User-agent: Googlebot
+Disallow: /
+
+User-agent: other
+User-agent: Gator
+Allow: /feeds/public
+Disallow: /feeds
+Disallow: /*.json$
+Crawl-delay: 2
+
+User-agent: *
+Disallow: /everything
+`)
+	rules := parseRobots(robots, robotsUserAgent)
+	tests := map[string]bool{
+		"/":                   true,
+		"/everything":         true,
+		"/feeds/rss.xml":      false,
+		"/feeds/public.xml":   true,
+		"/blog/feed.json":     false,
+		"/blog/feed.json?x=1": true,
+	}
+	for path, expect := range tests {
+		if rules.allowed(path) != expect {
+			t.Errorf("Error testing %v: expected allowed to be %v", path, expect)
+		}
+	}
+	if rules.crawlDelay != 2*time.Second {
+		t.Errorf("Error testing crawl delay: expected 2s but got %v", rules.crawlDelay)
+	}
+}
+
+// TestFetchRedirects checks that permanent redirects are reported as a move, but not once a temporary
+// redirect has been followed
+func TestFetchRedirects(t *testing.T) {
+	body := `<rss><channel><title>Blog</title></channel></rss>`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/today", http.StatusFound)
+	})
+	mux.HandleFunc("/today", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	mux.HandleFunc("/temporary", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/old", http.StatusTemporaryRedirect)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := testFetcher(t)
+	cases := []struct {
+		testName     string
+		path         string
+		movedTo      string
+		redirectedTo string
+	}{
+		{testName: "permanent then temporary", path: "/old", movedTo: "/new", redirectedTo: "/today"},
+		{testName: "temporary first", path: "/temporary", redirectedTo: "/today"},
+		{testName: "no redirect", path: "/today"},
+	}
+	for _, c := range cases {
+		_, cache, err := f.fetchFeed(context.Background(), server.URL+c.path, feedCache{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimPrefix(cache.MovedTo, server.URL) != c.movedTo {
+			t.Errorf("Error testing %v: expected to move to %q but got %q", c.testName, c.movedTo, cache.MovedTo)
+		}
+		if strings.TrimPrefix(cache.RedirectedTo, server.URL) != c.redirectedTo {
+			t.Errorf("Error testing %v: expected to be redirected to %q but got %q", c.testName, c.redirectedTo, cache.RedirectedTo)
+		}
+	}
+}
+
+// TestFetchClientSettings checks that the configured user agent is sent and that bodies over the size
+// limit are refused, whether or not the server says how big they are up front
+func TestFetchClientSettings(t *testing.T) {
+	body := `<rss><channel><title>A blog with a long title</title></channel></rss>`
+	var userAgent string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write([]byte(body))
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		for _, part := range []string{body[:20], body[20:]} {
+			w.Write([]byte(part))
+			w.(http.Flusher).Flush()
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f, err := newFetcher(config.Config{HostSpacing: "1ms", AllowedHosts: []string{"127.0.0.1"}, UserAgent: "gator-test", ContactURL: "https://example.com/bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = f.fetchFeed(context.Background(), server.URL+"/feed", feedCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userAgent != "gator-test (+https://example.com/bot)" {
+		t.Errorf("Error testing user agent: expected %q but got %q", "gator-test (+https://example.com/bot)", userAgent)
+	}
+
+	f, err = newFetcher(config.Config{HostSpacing: "1ms", AllowedHosts: []string{"127.0.0.1"}, MaxBodyBytes: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/feed", "/chunked"} {
+		_, _, err = f.fetchFeed(context.Background(), server.URL+path, feedCache{})
+		class, _ := classifyError(err)
+		if class != "too_large" {
+			t.Errorf("Error testing %v: expected too_large but got %v (%v)", path, class, err)
+		}
+	}
+
+	_, err = newFetcher(config.Config{ProxyURL: "://not a url"})
+	if err == nil {
+		t.Errorf("Error testing proxy_url: expected an invalid proxy to be an error")
+	}
+}
@@ -5,4 +5,7 @@ go 1.24.3
 require (
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.11.1
+	golang.org/x/net v0.47.0
 )
+
+require golang.org/x/text v0.31.0 // indirect
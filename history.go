@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// records a fetch of a feed in the feed_fetches table, whether it worked or not, with how long it took,
+// what came back and how many of the items were new
+func recordFetch(ctx context.Context, s *state, feed database.Feed, started time.Time, result scrapeResult, fetchErr error) {
+	statusCode := result.statusCode
+	var message string
+	if fetchErr != nil {
+		_, errStatus := classifyError(fetchErr)
+		statusCode = max(statusCode, errStatus)
+		message = fetchErr.Error()
+	}
+	err := s.db.CreateFeedFetch(ctx, database.CreateFeedFetchParams{
+		ID:         uuid.New(),
+		FeedID:     feed.ID,
+		StartedAt:  started,
+		DurationMs: int32(time.Since(started).Milliseconds()),
+		StatusCode: sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+		Bytes:      int64(result.bytes),
+		ItemsSeen:  int32(result.itemsSeen),
+		NewItems:   int32(result.saved),
+		Error:      sql.NullString{String: message, Valid: fetchErr != nil},
+	})
+	if err != nil {
+		fmt.Printf("Could not record the fetch of %v: %v\n", feed.Name, err)
+	}
+}
+
+// deletes fetches older than fetch_history_days from the fetch history
+func pruneFetchHistory(ctx context.Context, s *state) {
+	err := s.db.DeleteFeedFetchesBefore(ctx, time.Now().Add(-s.cfg.FetchHistoryRetention()))
+	if err != nil {
+		fmt.Printf("Could not prune the fetch history: %v\n", err)
+	}
+}
+
+// a summary of a feed's fetch history and recent posts
+type feedStats struct {
+	fetches   int
+	successes int
+	// the median time a fetch took, successful or not
+	medianDuration time.Duration
+	lastSuccess    time.Time
+	lastFailure    time.Time
+	lastError      string
+	// the number of items in the feed the last time it was fetched with any change
+	lastItemsSeen int
+	// the last fetch that found a new item
+	lastNewItem time.Time
+	// how often the feed publishes, 0 if there aren't enough posts to tell
+	postingInterval time.Duration
+	latestPost      time.Time
+}
+
+// summarises a feed's fetches, newest first, and the publication dates of its recent posts, newest first
+func summariseFeedStats(now time.Time, fetches []database.FeedFetch, postDates []time.Time) feedStats {
+	stats := feedStats{
+		fetches:         len(fetches),
+		postingInterval: postingInterval(now, postDates),
+	}
+	if len(postDates) > 0 {
+		stats.latestPost = postDates[0]
+	}
+	durations := make([]int32, 0, len(fetches))
+	for _, fetch := range fetches {
+		durations = append(durations, fetch.DurationMs)
+		if fetch.Error.Valid {
+			if stats.lastFailure.IsZero() {
+				stats.lastFailure = fetch.StartedAt
+				stats.lastError = fetch.Error.String
+			}
+			continue
+		}
+		stats.successes++
+		if stats.lastSuccess.IsZero() {
+			stats.lastSuccess = fetch.StartedAt
+		}
+		if stats.lastItemsSeen == 0 {
+			stats.lastItemsSeen = int(fetch.ItemsSeen)
+		}
+		if fetch.NewItems > 0 && stats.lastNewItem.IsZero() {
+			stats.lastNewItem = fetch.StartedAt
+		}
+	}
+	if len(durations) > 0 {
+		slices.Sort(durations)
+		middle := len(durations) / 2
+		median := durations[middle]
+		if len(durations)%2 == 0 {
+			median = (durations[middle-1] + durations[middle]) / 2
+		}
+		stats.medianDuration = time.Duration(median) * time.Millisecond
+	}
+	return stats
+}
+
+// prints a feed's stats for feedstats. history is how far back the fetch history goes
+func printFeedStats(w io.Writer, feed database.Feed, stats feedStats, history time.Duration) {
+	fmt.Fprintf(w, "Feed: %v (%v)\n", feed.Name, feed.Url)
+	if stats.fetches == 0 {
+		fmt.Fprintf(w, "Not fetched in the last %v days\n", int(history.Hours()/24))
+	} else {
+		fmt.Fprintf(w, "Fetches in the last %v days: %v, %v succeeded (%.0f%%)\n", int(history.Hours()/24), stats.fetches, stats.successes, 100*float64(stats.successes)/float64(stats.fetches))
+		fmt.Fprintf(w, "Median fetch time: %v\n", stats.medianDuration)
+	}
+	fmt.Fprintf(w, "Last success: %v\n", formatStatTime(stats.lastSuccess))
+	if !stats.lastFailure.IsZero() {
+		fmt.Fprintf(w, "Last failure: %v: %v\n", formatStatTime(stats.lastFailure), stats.lastError)
+	}
+	if stats.lastItemsSeen > 0 {
+		fmt.Fprintf(w, "Items in the feed: %v\n", stats.lastItemsSeen)
+	}
+	fmt.Fprintf(w, "Last new item found: %v\n", formatStatTime(stats.lastNewItem))
+	fmt.Fprintf(w, "Latest post published: %v\n", formatStatTime(stats.latestPost))
+	if stats.postingInterval > 0 {
+		fmt.Fprintf(w, "Posts about every: %v\n", stats.postingInterval.Round(time.Minute))
+	}
+}
+
+// prints a table of every feed with how its fetches are going, for feeds --status
+func printFeedStatuses(w io.Writer, feeds []database.GetFeedStatusesRow) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSTATUS\tSUCCEEDED\tLAST SUCCESS\tNEXT FETCH")
+	for _, feed := range feeds {
+		status := "ok"
+		next := feed.NextFetchAt
+		if feed.DisabledAt.Valid {
+			status = "disabled"
+			next = sql.NullTime{}
+		} else if feed.ConsecutiveFailures > 0 {
+			status = fmt.Sprintf("failing (%v)", feed.ConsecutiveFailures)
+			next = feed.NextRetryAt
+		} else if feed.NextRetryAt.Valid {
+			// we held off fetching it to be polite to its host
+			status = "waiting"
+			next = feed.NextRetryAt
+		}
+		succeeded := "-"
+		if feed.Fetches > 0 {
+			succeeded = fmt.Sprintf("%v/%v", feed.Successes, feed.Fetches)
+		}
+		nextFetch := "-"
+		if next.Valid {
+			nextFetch = formatStatTime(next.Time)
+		} else if !feed.DisabledAt.Valid {
+			nextFetch = "due"
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\n", feed.Name, status, succeeded, formatStatTime(feed.LastSuccess.Time), nextFetch)
+	}
+	return table.Flush()
+}
+
+// formats a time for the stats, or says it never happened
+func formatStatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.DateTime)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+)
+
+// TestSummariseFeedStats checks the success rate, median fetch time and posting frequency worked out from
+// a feed's history
+func TestSummariseFeedStats(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	fetches := []database.FeedFetch{
+		{StartedAt: now.Add(-time.Hour), DurationMs: 900, Error: sql.NullString{String: "timeout", Valid: true}},
+		{StartedAt: now.Add(-2 * time.Hour), DurationMs: 100, ItemsSeen: 0},
+		{StartedAt: now.Add(-3 * time.Hour), DurationMs: 300, ItemsSeen: 20, NewItems: 2},
+		{StartedAt: now.Add(-4 * time.Hour), DurationMs: 200, ItemsSeen: 19, NewItems: 1},
+	}
+	postDates := []time.Time{now.Add(-3 * time.Hour), now.Add(-24 * time.Hour), now.Add(-48 * time.Hour)}
+
+	stats := summariseFeedStats(now, fetches, postDates)
+	cases := []struct {
+		testName string
+		expect   any
+		actual   any
+	}{
+		{testName: "fetches", expect: 4, actual: stats.fetches},
+		{testName: "successes", expect: 3, actual: stats.successes},
+		{testName: "median duration", expect: 250 * time.Millisecond, actual: stats.medianDuration},
+		{testName: "last success", expect: now.Add(-2 * time.Hour), actual: stats.lastSuccess},
+		{testName: "last error", expect: "timeout", actual: stats.lastError},
+		{testName: "items seen", expect: 20, actual: stats.lastItemsSeen},
+		{testName: "last new item", expect: now.Add(-3 * time.Hour), actual: stats.lastNewItem},
+		{testName: "posting interval", expect: 16 * time.Hour, actual: stats.postingInterval},
+		{testName: "latest post", expect: now.Add(-3 * time.Hour), actual: stats.latestPost},
+	}
+	for _, c := range cases {
+		if c.actual != c.expect {
+			t.Errorf("Error testing %v: expected %v but got %v", c.testName, c.expect, c.actual)
+		}
+	}
+}
+
+// TestPrintFeedStatuses checks each feed's status is shown in the table
+func TestPrintFeedStatuses(t *testing.T) {
+	var out bytes.Buffer
+	err := printFeedStatuses(&out, []database.GetFeedStatusesRow{
+		{Name: "Working", Fetches: 4, Successes: 4, LastSuccess: sql.NullTime{Time: time.Now(), Valid: true}},
+		{Name: "Failing", ConsecutiveFailures: 3, Fetches: 4, Successes: 1},
+		{Name: "Dead", ConsecutiveFailures: 10, DisabledAt: sql.NullTime{Time: time.Now(), Valid: true}},
+		{Name: "Waiting", NextRetryAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}},
+	})
+	if err != nil {
+		t.Fatalf("Error testing statuses: expected no error but got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expect := [][]string{
+		{"NAME", "STATUS"},
+		{"Working", "ok", "4/4", "due"},
+		{"Failing", "failing (3)", "1/4", "never"},
+		{"Dead", "disabled", "-", "never"},
+		{"Waiting", "waiting", "-", "never"},
+	}
+	if len(lines) != len(expect) {
+		t.Fatalf("Error testing statuses: expected %v lines but got\n%v", len(expect), out.String())
+	}
+	for x, words := range expect {
+		for _, word := range words {
+			if !strings.Contains(lines[x], word) {
+				t.Errorf("Error testing statuses: expected %q in line %q", word, lines[x])
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long we wait before asking a host again when it responds 429 or 503 without a Retry-After header
+const defaultRetryAfter = 5 * time.Minute
+
+// the longest we will honour a Retry-After for, so a broken header can't stop a feed forever
+const maxRetryAfter = 24 * time.Hour
+
+// the hostLimiter keeps us polite to the servers we fetch from. It limits how many requests are made to
+// a host at once, spaces requests to the same host out, and stops requests to a host that has asked
+// us to back off. It also caches each host's robots.txt
+type hostLimiter struct {
+	spacing     time.Duration
+	concurrency int
+	mu          sync.Mutex
+	hosts       map[string]*hostState
+}
+
+// what we know about a single host
+type hostState struct {
+	slots        chan struct{}
+	nextRequest  time.Time
+	retryAfter   time.Time
+	robots       robotsRules
+	robotsExpiry time.Time
+}
+
+// creates a hostLimiter that leaves at least spacing between the start of requests to the same host,
+// and makes no more than concurrency requests to a host at once
+func newHostLimiter(spacing time.Duration, concurrency int) *hostLimiter {
+	return &hostLimiter{
+		spacing:     spacing,
+		concurrency: max(concurrency, 1),
+		hosts:       make(map[string]*hostState),
+	}
+}
+
+// returns the state for a host, creating it the first time the host is seen. The caller must hold h.mu
+func (h *hostLimiter) host(host string) *hostState {
+	state, exists := h.hosts[host]
+	if !exists {
+		state = &hostState{slots: make(chan struct{}, h.concurrency)}
+		h.hosts[host] = state
+	}
+	return state
+}
+
+// waits until a request can be made to the host. It returns an error straight away if the host has
+// asked us to back off, otherwise it waits for a free slot and for the spacing since the last request
+// to pass. The returned function must be called when the request is finished to free the slot
+func (h *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	h.mu.Lock()
+	state := h.host(host)
+	slots := state.slots
+	h.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slots }
+
+	h.mu.Lock()
+	now := time.Now()
+	if now.Before(state.retryAfter) {
+		h.mu.Unlock()
+		release()
+		return nil, &waitError{
+			reason:  errHostBackoff,
+			until:   state.retryAfter,
+			message: fmt.Sprintf("%v asked us not to make requests until %v", host, state.retryAfter.Format(time.RFC1123)),
+		}
+	}
+	start := now
+	if state.nextRequest.After(now) {
+		start = state.nextRequest
+	}
+	spacing := max(h.spacing, state.robots.crawlDelay)
+	state.nextRequest = start.Add(spacing)
+	h.mu.Unlock()
+
+	wait := time.Until(start)
+	if wait <= 0 {
+		return release, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// changes the spacing and number of requests at once, keeping everything else we know about each host
+// such as backoffs and robots.txt. Requests already under way finish under the old limit
+func (h *hostLimiter) setLimits(spacing time.Duration, concurrency int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.spacing = spacing
+	h.concurrency = max(concurrency, 1)
+	for _, state := range h.hosts {
+		if cap(state.slots) != h.concurrency {
+			state.slots = make(chan struct{}, h.concurrency)
+		}
+	}
+}
+
+// stops requests to a host for the given amount of time
+func (h *hostLimiter) backoff(host string, wait time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.host(host).retryAfter = time.Now().Add(wait)
+}
+
+// returns the cached robots.txt rules for a host and when they expire, if they haven't expired yet
+func (h *hostLimiter) cachedRobots(host string) (robotsRules, time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := h.host(host)
+	if time.Now().After(state.robotsExpiry) {
+		return robotsRules{}, time.Time{}, false
+	}
+	return state.robots, state.robotsExpiry, true
+}
+
+// caches the robots.txt rules for a host until expiry
+func (h *hostLimiter) cacheRobots(host string, rules robotsRules, expiry time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := h.host(host)
+	state.robots = rules
+	state.robotsExpiry = expiry
+}
+
+// works out how long a Retry-After header is asking us to wait. It can be a number of seconds or an
+// HTTP date. A missing or broken header gets the default wait
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	wait := defaultRetryAfter
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = date.Sub(now)
+	}
+	return min(max(wait, 0), maxRetryAfter)
+}
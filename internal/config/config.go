@@ -3,17 +3,90 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"time"
 )
 
 // the config struct represents the structure of a json file stored in the users home directory
 type Config struct {
-	DbURL           string `json:"db_url"`
-	CurrentUserName string `json:"current_user_name"`
+	DbURL            string   `json:"db_url"`
+	CurrentUserName  string   `json:"current_user_name"`
+	DownloadDir      string   `json:"download_dir,omitempty"`
+	DownloadKeepLast int      `json:"download_keep_last,omitempty"`
+	AggWorkers       int      `json:"agg_workers,omitempty"`
+	FetchTimeout     string   `json:"fetch_timeout,omitempty"`
+	HostSpacing      string   `json:"host_spacing,omitempty"`
+	HostConcurrency  int      `json:"host_concurrency,omitempty"`
+	DisableAfter     int      `json:"disable_after,omitempty"`
+	MinRefresh       string   `json:"min_refresh,omitempty"`
+	MaxRefresh       string   `json:"max_refresh,omitempty"`
+	ConnectTimeout   string   `json:"connect_timeout,omitempty"`
+	ResponseTimeout  string   `json:"response_timeout,omitempty"`
+	RequestTimeout   string   `json:"request_timeout,omitempty"`
+	MaxBodyBytes     int64    `json:"max_body_bytes,omitempty"`
+	ProxyURL         string   `json:"proxy_url,omitempty"`
+	UserAgent        string   `json:"user_agent,omitempty"`
+	ContactURL       string   `json:"contact_url,omitempty"`
+	CABundle         string   `json:"ca_bundle,omitempty"`
+	TLSMinVersion    string   `json:"tls_min_version,omitempty"`
+	AllowedHosts     []string `json:"allowed_hosts,omitempty"`
+	WebSubCallback   string   `json:"websub_callback,omitempty"`
+	WebSubListen     string   `json:"websub_listen,omitempty"`
+	ShutdownTimeout  string   `json:"shutdown_timeout,omitempty"`
+	FetchHistoryDays int      `json:"fetch_history_days,omitempty"`
 }
 
 // the name of the conifg file
 const configFileName = ".gatorconfig.json"
 
+// the directory podcast episodes are downloaded into when download_dir isn't set, relative to the users
+// home directory
+const defaultDownloadDir = "gator-downloads"
+
+// the number of episodes kept for each feed when download_keep_last isn't set
+const defaultDownloadKeepLast = 5
+
+// the number of feeds agg fetches at the same time when agg_workers isn't set
+const defaultAggWorkers = 4
+
+// how long a single feed can take to fetch and save when fetch_timeout isn't set
+const defaultFetchTimeout = 30 * time.Second
+
+// the least time left between requests to the same host when host_spacing isn't set
+const defaultHostSpacing = time.Second
+
+// the number of requests made to the same host at once when host_concurrency isn't set
+const defaultHostConcurrency = 2
+
+// the number of failed fetches in a row before a feed is disabled when disable_after isn't set
+const defaultDisableAfter = 10
+
+// the longest a feed is left between fetches when max_refresh isn't set
+const defaultMaxRefresh = 24 * time.Hour
+
+// how long connecting to a server, including the TLS handshake, can take when connect_timeout isn't set
+const defaultConnectTimeout = 10 * time.Second
+
+// how long a server can take to start responding once the request is sent when response_timeout isn't set
+const defaultResponseTimeout = 30 * time.Second
+
+// how long a whole request, including reading the body, can take when request_timeout isn't set
+const defaultRequestTimeout = time.Minute
+
+// the biggest response body read when max_body_bytes isn't set
+const defaultMaxBodyBytes = 10 * 1024 * 1024
+
+// the user agent sent with every request when user_agent isn't set
+const defaultUserAgent = "gator"
+
+// the address agg listens on for WebSub callbacks when websub_listen isn't set
+const defaultWebSubListen = ":8080"
+
+// how long agg waits for fetches in progress to finish when it is stopped, when shutdown_timeout isn't set
+const defaultShutdownTimeout = 30 * time.Second
+
+// the number of days of fetch history kept when fetch_history_days isn't set
+const defaultFetchHistoryDays = 30
+
 // a public function allowing the config file to be read. Note that there is no logic to create
 // the file if it does not exist yet. If the file does not exit, this will always throw an error,
 // if the file does exist, a populated Config struct will be returned
@@ -44,6 +117,160 @@ func (config Config) SetUser(userName string) error {
 	return nil
 }
 
+// returns the directory podcast episodes should be downloaded into. If it isn't set in the config file
+// a directory in the users home directory is used
+func (config Config) DownloadDirectory() (string, error) {
+	if config.DownloadDir != "" {
+		return config.DownloadDir, nil
+	}
+	path, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path + "/" + defaultDownloadDir, nil
+}
+
+// returns how many of the most recent episodes of each feed should be kept on disk
+func (config Config) DownloadKeep() int {
+	if config.DownloadKeepLast > 0 {
+		return config.DownloadKeepLast
+	}
+	return defaultDownloadKeepLast
+}
+
+// returns how many feeds agg should fetch at the same time
+func (config Config) AggWorkerCount() int {
+	if config.AggWorkers > 0 {
+		return config.AggWorkers
+	}
+	return defaultAggWorkers
+}
+
+// returns how long a single feed can take to fetch and save. The fetch_timeout setting is a duration
+// like "30s" or "1m"
+func (config Config) FetchTimeoutDuration() (time.Duration, error) {
+	if config.FetchTimeout == "" {
+		return defaultFetchTimeout, nil
+	}
+	return time.ParseDuration(config.FetchTimeout)
+}
+
+// returns the least time to leave between requests to the same host. The host_spacing setting is a
+// duration like "500ms" or "2s"
+func (config Config) HostSpacingDuration() (time.Duration, error) {
+	if config.HostSpacing == "" {
+		return defaultHostSpacing, nil
+	}
+	return time.ParseDuration(config.HostSpacing)
+}
+
+// returns how many requests can be made to the same host at once
+func (config Config) HostConcurrencyLimit() int {
+	if config.HostConcurrency > 0 {
+		return config.HostConcurrency
+	}
+	return defaultHostConcurrency
+}
+
+// returns how many times in a row a feed can fail to fetch before it is disabled
+func (config Config) DisableAfterFailures() int {
+	if config.DisableAfter > 0 {
+		return config.DisableAfter
+	}
+	return defaultDisableAfter
+}
+
+// returns the least time to leave between fetches of the same feed. The min_refresh setting is a duration
+// like "15m", when it isn't set the agg interval is the only limit so this returns 0
+func (config Config) MinRefreshDuration() (time.Duration, error) {
+	if config.MinRefresh == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(config.MinRefresh)
+}
+
+// returns the most time to leave between fetches of the same feed. The max_refresh setting is a duration
+// like "12h"
+func (config Config) MaxRefreshDuration() (time.Duration, error) {
+	if config.MaxRefresh == "" {
+		return defaultMaxRefresh, nil
+	}
+	return time.ParseDuration(config.MaxRefresh)
+}
+
+// returns how long connecting to a server, including the TLS handshake, can take. The connect_timeout
+// setting is a duration like "10s"
+func (config Config) ConnectTimeoutDuration() (time.Duration, error) {
+	if config.ConnectTimeout == "" {
+		return defaultConnectTimeout, nil
+	}
+	return time.ParseDuration(config.ConnectTimeout)
+}
+
+// returns how long a server can take to send the headers of its response. The response_timeout setting
+// is a duration like "30s"
+func (config Config) ResponseTimeoutDuration() (time.Duration, error) {
+	if config.ResponseTimeout == "" {
+		return defaultResponseTimeout, nil
+	}
+	return time.ParseDuration(config.ResponseTimeout)
+}
+
+// returns how long a single request can take from start to finish. The request_timeout setting is a
+// duration like "1m"
+func (config Config) RequestTimeoutDuration() (time.Duration, error) {
+	if config.RequestTimeout == "" {
+		return defaultRequestTimeout, nil
+	}
+	return time.ParseDuration(config.RequestTimeout)
+}
+
+// returns the most bytes that will be read from a response body
+func (config Config) MaxBodySize() int64 {
+	if config.MaxBodyBytes > 0 {
+		return config.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+// returns the User-Agent header to send. If contact_url is set it is added so server owners can get in
+// touch, e.g. "gator (+https://example.com/about-my-bot)"
+func (config Config) UserAgentString() string {
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	if config.ContactURL != "" {
+		userAgent += " (+" + config.ContactURL + ")"
+	}
+	return userAgent
+}
+
+// returns the address agg listens on for WebSub callbacks. Only used when websub_callback is set
+func (config Config) WebSubListenAddress() string {
+	if config.WebSubListen != "" {
+		return config.WebSubListen
+	}
+	return defaultWebSubListen
+}
+
+// returns how long agg waits for fetches in progress to finish once it has been asked to stop
+func (config Config) ShutdownTimeoutDuration() (time.Duration, error) {
+	if config.ShutdownTimeout == "" {
+		return defaultShutdownTimeout, nil
+	}
+	return time.ParseDuration(config.ShutdownTimeout)
+}
+
+// returns how long each fetch is kept in the fetch history
+func (config Config) FetchHistoryRetention() time.Duration {
+	days := defaultFetchHistoryDays
+	if config.FetchHistoryDays > 0 {
+		days = config.FetchHistoryDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
 // private function allowing a new config to be written to the original file
 func write(config Config) error {
 	jsonData, err := json.Marshal(config)
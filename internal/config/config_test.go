@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -64,7 +65,7 @@ func TestSetUserConfig(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		if got != test.expect {
+		if !reflect.DeepEqual(got, test.expect) {
 			t.Errorf("Error testing %v: expected %v but got %v", test.testName, test.expect, got)
 		}
 	}
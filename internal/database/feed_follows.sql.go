@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -85,6 +86,44 @@ func (q *Queries) DeleteFollowedFeed(ctx context.Context, arg DeleteFollowedFeed
 	return err
 }
 
+const getDisabledFeedsUserFollows = `-- name: GetDisabledFeedsUserFollows :many
+SELECT f.name, f.url, f.disabled_at
+FROM feeds f
+INNER JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+AND f.disabled_at IS NOT NULL
+ORDER BY f.name
+`
+
+type GetDisabledFeedsUserFollowsRow struct {
+	Name       string
+	Url        string
+	DisabledAt sql.NullTime
+}
+
+func (q *Queries) GetDisabledFeedsUserFollows(ctx context.Context, userID uuid.UUID) ([]GetDisabledFeedsUserFollowsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDisabledFeedsUserFollows, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDisabledFeedsUserFollowsRow
+	for rows.Next() {
+		var i GetDisabledFeedsUserFollowsRow
+		if err := rows.Scan(&i.Name, &i.Url, &i.DisabledAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFeedsUserFollows = `-- name: GetFeedsUserFollows :many
 SELECT ff.id, ff.created_at, ff.updated_at, ff.user_id, ff.feed_id, u.name as user_name, f.name as feed_name 
 FROM feed_follows ff 
@@ -133,3 +172,20 @@ func (q *Queries) GetFeedsUserFollows(ctx context.Context, userID uuid.UUID) ([]
 	}
 	return items, nil
 }
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = $1, updated_at = NOW()
+WHERE feed_id = $2
+AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = $1)
+`
+
+type MoveFeedFollowsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
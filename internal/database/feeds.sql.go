@@ -13,6 +13,105 @@ import (
 	"github.com/google/uuid"
 )
 
+const claimFeed = `-- name: ClaimFeed :one
+UPDATE feeds
+SET claimed_until = NOW() + $1::integer * INTERVAL '1 second'
+WHERE id = $2
+AND (claimed_until IS NULL OR claimed_until < NOW())
+RETURNING id, created_at, updated_at, last_fetched_at, name, url, user_id, last_warning, etag, last_modified, content_hash, claimed_until, consecutive_failures, next_retry_at, disabled_at, next_fetch_at
+`
+
+type ClaimFeedParams struct {
+	LeaseSeconds int32
+	ID           uuid.UUID
+}
+
+func (q *Queries) ClaimFeed(ctx context.Context, arg ClaimFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimFeed, arg.LeaseSeconds, arg.ID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastWarning,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.NextRetryAt,
+		&i.DisabledAt,
+		&i.NextFetchAt,
+	)
+	return i, err
+}
+
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET claimed_until = NOW() + $1::integer * INTERVAL '1 second'
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+    AND (COALESCE(next_retry_at, next_fetch_at) IS NULL OR COALESCE(next_retry_at, next_fetch_at) <= $2::timestamp)
+    AND (claimed_until IS NULL OR claimed_until < NOW())
+    ORDER BY COALESCE(next_retry_at, next_fetch_at)
+    NULLS FIRST
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, last_fetched_at, name, url, user_id, last_warning, etag, last_modified, content_hash, claimed_until, consecutive_failures, next_retry_at, disabled_at, next_fetch_at
+`
+
+type ClaimFeedsToFetchParams struct {
+	LeaseSeconds int32
+	DueBefore    time.Time
+	BatchSize    int32
+}
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.LeaseSeconds, arg.DueBefore, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastWarning,
+			&i.Etag,
+			&i.LastModified,
+			&i.ContentHash,
+			&i.ClaimedUntil,
+			&i.ConsecutiveFailures,
+			&i.NextRetryAt,
+			&i.DisabledAt,
+			&i.NextFetchAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
 VALUES (
@@ -23,7 +122,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, last_fetched_at, name, url, user_id
+RETURNING id, created_at, updated_at, last_fetched_at, name, url, user_id, last_warning, etag, last_modified, content_hash, claimed_until, consecutive_failures, next_retry_at, disabled_at, next_fetch_at
 `
 
 type CreateFeedParams struct {
@@ -53,24 +152,194 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Name,
 		&i.Url,
 		&i.UserID,
+		&i.LastWarning,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.NextRetryAt,
+		&i.DisabledAt,
+		&i.NextFetchAt,
+	)
+	return i, err
+}
+
+const deferFeed = `-- name: DeferFeed :exec
+UPDATE feeds
+SET updated_at = NOW(), claimed_until = NULL, next_retry_at = $2
+WHERE id = $1
+`
+
+type DeferFeedParams struct {
+	ID          uuid.UUID
+	NextRetryAt sql.NullTime
+}
+
+func (q *Queries) DeferFeed(ctx context.Context, arg DeferFeedParams) error {
+	_, err := q.db.ExecContext(ctx, deferFeed, arg.ID, arg.NextRetryAt)
+	return err
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const getBrokenFeeds = `-- name: GetBrokenFeeds :many
+SELECT f.id, f.created_at, f.updated_at, f.last_fetched_at, f.name, f.url, f.user_id, f.last_warning, f.etag, f.last_modified, f.content_hash, f.claimed_until, f.consecutive_failures, f.next_retry_at, f.disabled_at, f.next_fetch_at, u.name as user_name FROM feeds f
+INNER JOIN users u ON f.user_id = u.id
+WHERE f.consecutive_failures > 0
+ORDER BY f.disabled_at NULLS LAST, f.consecutive_failures DESC
+`
+
+type GetBrokenFeedsRow struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	LastFetchedAt       sql.NullTime
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastWarning         sql.NullString
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	ContentHash         sql.NullString
+	ClaimedUntil        sql.NullTime
+	ConsecutiveFailures int32
+	NextRetryAt         sql.NullTime
+	DisabledAt          sql.NullTime
+	NextFetchAt         sql.NullTime
+	UserName            string
+}
+
+func (q *Queries) GetBrokenFeeds(ctx context.Context) ([]GetBrokenFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getBrokenFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetBrokenFeedsRow
+	for rows.Next() {
+		var i GetBrokenFeedsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastWarning,
+			&i.Etag,
+			&i.LastModified,
+			&i.ContentHash,
+			&i.ClaimedUntil,
+			&i.ConsecutiveFailures,
+			&i.NextRetryAt,
+			&i.DisabledAt,
+			&i.NextFetchAt,
+			&i.UserName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeedByID = `-- name: GetFeedByID :one
+SELECT id, created_at, updated_at, last_fetched_at, name, url, user_id, last_warning, etag, last_modified, content_hash, claimed_until, consecutive_failures, next_retry_at, disabled_at, next_fetch_at FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) GetFeedByID(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByID, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastWarning,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.NextRetryAt,
+		&i.DisabledAt,
+		&i.NextFetchAt,
+	)
+	return i, err
+}
+
+const getFeedByName = `-- name: GetFeedByName :one
+SELECT id, created_at, updated_at, last_fetched_at, name, url, user_id, last_warning, etag, last_modified, content_hash, claimed_until, consecutive_failures, next_retry_at, disabled_at, next_fetch_at FROM feeds
+WHERE name = $1
+`
+
+func (q *Queries) GetFeedByName(ctx context.Context, name string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByName, name)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastWarning,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.NextRetryAt,
+		&i.DisabledAt,
+		&i.NextFetchAt,
 	)
 	return i, err
 }
 
 const getFeedsAndUserName = `-- name: GetFeedsAndUserName :many
-SELECT f.id, f.created_at, f.updated_at, f.last_fetched_at, f.name, f.url, f.user_id, u.name as user_name FROM feeds f 
+SELECT f.id, f.created_at, f.updated_at, f.last_fetched_at, f.name, f.url, f.user_id, f.last_warning, f.etag, f.last_modified, f.content_hash, f.claimed_until, f.consecutive_failures, f.next_retry_at, f.disabled_at, f.next_fetch_at, u.name as user_name FROM feeds f 
 INNER JOIN users u ON f.user_id = u.id
 `
 
 type GetFeedsAndUserNameRow struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	LastFetchedAt sql.NullTime
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	UserName      string
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	LastFetchedAt       sql.NullTime
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastWarning         sql.NullString
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	ContentHash         sql.NullString
+	ClaimedUntil        sql.NullTime
+	ConsecutiveFailures int32
+	NextRetryAt         sql.NullTime
+	DisabledAt          sql.NullTime
+	NextFetchAt         sql.NullTime
+	UserName            string
 }
 
 func (q *Queries) GetFeedsAndUserName(ctx context.Context) ([]GetFeedsAndUserNameRow, error) {
@@ -90,6 +359,15 @@ func (q *Queries) GetFeedsAndUserName(ctx context.Context) ([]GetFeedsAndUserNam
 			&i.Name,
 			&i.Url,
 			&i.UserID,
+			&i.LastWarning,
+			&i.Etag,
+			&i.LastModified,
+			&i.ContentHash,
+			&i.ClaimedUntil,
+			&i.ConsecutiveFailures,
+			&i.NextRetryAt,
+			&i.DisabledAt,
+			&i.NextFetchAt,
 			&i.UserName,
 		); err != nil {
 			return nil, err
@@ -106,8 +384,11 @@ func (q *Queries) GetFeedsAndUserName(ctx context.Context) ([]GetFeedsAndUserNam
 }
 
 const getFeedsByURL = `-- name: GetFeedsByURL :one
-SELECT id, created_at, updated_at, last_fetched_at, name, url, user_id FROM feeds
-WHERE url = $1
+SELECT f.id, f.created_at, f.updated_at, f.last_fetched_at, f.name, f.url, f.user_id, f.last_warning, f.etag, f.last_modified, f.content_hash, f.claimed_until, f.consecutive_failures, f.next_retry_at, f.disabled_at, f.next_fetch_at FROM feeds f
+WHERE f.url = $1
+OR f.id = (SELECT feed_id FROM feed_url_history WHERE feed_url_history.url = $1)
+ORDER BY f.url = $1 DESC
+LIMIT 1
 `
 
 func (q *Queries) GetFeedsByURL(ctx context.Context, url string) (Feed, error) {
@@ -121,19 +402,37 @@ func (q *Queries) GetFeedsByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Name,
 		&i.Url,
 		&i.UserID,
+		&i.LastWarning,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.NextRetryAt,
+		&i.DisabledAt,
+		&i.NextFetchAt,
 	)
 	return i, err
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, last_fetched_at, name, url, user_id FROM feeds 
-ORDER BY last_fetched_at 
-NULLS FIRST 
-LIMIT 1
+const markFeedFailed = `-- name: MarkFeedFailed :one
+UPDATE feeds
+SET updated_at = NOW(), last_fetched_at = NOW(), claimed_until = NULL,
+    consecutive_failures = consecutive_failures + 1,
+    next_retry_at = $1::timestamp,
+    disabled_at = CASE WHEN consecutive_failures + 1 >= $2::integer THEN NOW() ELSE disabled_at END
+WHERE id = $3
+RETURNING id, created_at, updated_at, last_fetched_at, name, url, user_id, last_warning, etag, last_modified, content_hash, claimed_until, consecutive_failures, next_retry_at, disabled_at, next_fetch_at
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type MarkFeedFailedParams struct {
+	RetryAt      time.Time
+	DisableAfter int32
+	ID           uuid.UUID
+}
+
+func (q *Queries) MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFailed, arg.RetryAt, arg.DisableAfter, arg.ID)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -143,17 +442,133 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Name,
 		&i.Url,
 		&i.UserID,
+		&i.LastWarning,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.NextRetryAt,
+		&i.DisabledAt,
+		&i.NextFetchAt,
 	)
 	return i, err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :exec
 UPDATE feeds
-SET updated_at = NOW(), last_fetched_at = NOW()
+SET updated_at = NOW(), last_fetched_at = NOW(), claimed_until = NULL, consecutive_failures = 0, next_retry_at = NULL, next_fetch_at = $2
+WHERE id = $1
+`
+
+type MarkFeedFetchedParams struct {
+	ID          uuid.UUID
+	NextFetchAt sql.NullTime
+}
+
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.ID, arg.NextFetchAt)
+	return err
+}
+
+const reenableFeed = `-- name: ReenableFeed :one
+UPDATE feeds
+SET updated_at = NOW(), consecutive_failures = 0, next_retry_at = NULL, disabled_at = NULL
+WHERE url = $1
+RETURNING id, created_at, updated_at, last_fetched_at, name, url, user_id, last_warning, etag, last_modified, content_hash, claimed_until, consecutive_failures, next_retry_at, disabled_at, next_fetch_at
+`
+
+func (q *Queries) ReenableFeed(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, reenableFeed, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastWarning,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.NextRetryAt,
+		&i.DisabledAt,
+		&i.NextFetchAt,
+	)
+	return i, err
+}
+
+const setFeedCache = `-- name: SetFeedCache :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, content_hash = $4
+WHERE id = $1
+`
+
+type SetFeedCacheParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+	ContentHash  sql.NullString
+}
+
+func (q *Queries) SetFeedCache(ctx context.Context, arg SetFeedCacheParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedCache,
+		arg.ID,
+		arg.Etag,
+		arg.LastModified,
+		arg.ContentHash,
+	)
+	return err
+}
+
+const setFeedNextFetch = `-- name: SetFeedNextFetch :exec
+UPDATE feeds
+SET updated_at = NOW(), last_fetched_at = NOW(), next_fetch_at = $2
+WHERE id = $1
+`
+
+type SetFeedNextFetchParams struct {
+	ID          uuid.UUID
+	NextFetchAt sql.NullTime
+}
+
+func (q *Queries) SetFeedNextFetch(ctx context.Context, arg SetFeedNextFetchParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedNextFetch, arg.ID, arg.NextFetchAt)
+	return err
+}
+
+const setFeedURL = `-- name: SetFeedURL :exec
+UPDATE feeds
+SET url = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetFeedURLParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) SetFeedURL(ctx context.Context, arg SetFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedURL, arg.ID, arg.Url)
+	return err
+}
+
+const setFeedWarning = `-- name: SetFeedWarning :exec
+UPDATE feeds
+SET last_warning = $2
 WHERE id = $1
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+type SetFeedWarningParams struct {
+	ID          uuid.UUID
+	LastWarning sql.NullString
+}
+
+func (q *Queries) SetFeedWarning(ctx context.Context, arg SetFeedWarningParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedWarning, arg.ID, arg.LastWarning)
 	return err
 }
@@ -11,14 +11,56 @@ import (
 	"github.com/google/uuid"
 )
 
+type Enclosure struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	PostID          uuid.UUID
+	Url             string
+	MimeType        string
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+	ImageUrl        sql.NullString
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	LastFetchedAt sql.NullTime
-	Name          string
-	Url           string
-	UserID        uuid.UUID
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	LastFetchedAt       sql.NullTime
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastWarning         sql.NullString
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	ContentHash         sql.NullString
+	ClaimedUntil        sql.NullTime
+	ConsecutiveFailures int32
+	NextRetryAt         sql.NullTime
+	DisabledAt          sql.NullTime
+	NextFetchAt         sql.NullTime
+}
+
+type FeedFailure struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	FeedID     uuid.UUID
+	StatusCode sql.NullInt32
+	ErrorClass string
+	Message    string
+}
+
+type FeedFetch struct {
+	ID         uuid.UUID
+	FeedID     uuid.UUID
+	StartedAt  time.Time
+	DurationMs int32
+	StatusCode sql.NullInt32
+	Bytes      int64
+	ItemsSeen  int32
+	NewItems   int32
+	Error      sql.NullString
 }
 
 type FeedFollow struct {
@@ -29,15 +71,27 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedUrlHistory struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	FeedID    uuid.UUID
+	Url       string
+}
+
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description string
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Title           string
+	Url             string
+	Description     string
+	PublishedAt     time.Time
+	FeedID          uuid.UUID
+	Content         string
+	Author          string
+	Guid            string
+	GuidIsPermalink bool
+	Categories      []string
 }
 
 type User struct {
@@ -46,3 +100,15 @@ type User struct {
 	UpdatedAt time.Time
 	Name      string
 }
+
+type WebsubSubscription struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FeedID         uuid.UUID
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	VerifiedAt     sql.NullTime
+	LeaseExpiresAt sql.NullTime
+}
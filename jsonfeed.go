@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// the JSONFeed struct represents a JSON Feed document (https://jsonfeed.org). Both version 1.0 and 1.1
+// are handled, the only real difference being that 1.1 replaced author with a list of authors
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	Image         string               `json:"image"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *JSONFeedAuthor      `json:"author"`
+	Authors       []JSONFeedAuthor     `json:"authors"`
+	Tags          []string             `json:"tags"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	Title             string  `json:"title"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// unmarshals a JSON Feed document and converts it into an RSSFeed
+func parseJSONFeed(body []byte) (*RSSFeed, error) {
+	var feed JSONFeed
+	err := json.Unmarshal(body, &feed)
+	if err != nil {
+		return nil, err
+	}
+	return feed.toRSSFeed(), nil
+}
+
+// converts the JSON feed into the RSSFeed struct used by scrapeFeeds. JSON Feed items don't need a
+// title or a url so we fall back to the summary and the external url when they are missing. The id is
+// only a permalink if it is the same as the url
+func (j JSONFeed) toRSSFeed() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = j.Title
+	feed.Channel.Link = j.HomePageURL
+	feed.Channel.Description = j.Description
+	if j.FeedURL != "" {
+		feed.Channel.AtomLinks = []AtomLink{{Href: j.FeedURL, Rel: "self"}}
+	}
+	for _, jsonItem := range j.Items {
+		item := RSSItem{
+			Title:       jsonItem.Title,
+			Link:        jsonItem.URL,
+			Description: jsonItem.Summary,
+			Content:     jsonItem.ContentHTML,
+			PubDate:     jsonItem.DatePublished,
+			GUID:        RSSGUID{Value: jsonItem.ID, IsPermaLink: "false"},
+			Categories:  jsonItem.Tags,
+		}
+		if jsonItem.ID != "" && jsonItem.ID == jsonItem.URL {
+			item.GUID.IsPermaLink = "true"
+		}
+		if item.Title == "" {
+			item.Title = jsonItem.Summary
+		}
+		if item.Link == "" {
+			item.Link = jsonItem.ExternalURL
+		}
+		if item.Content == "" {
+			item.Content = jsonItem.ContentText
+		}
+		if item.Description == "" {
+			item.Description = item.Content
+		}
+		if item.PubDate == "" {
+			item.PubDate = jsonItem.DateModified
+		}
+		if len(jsonItem.Authors) > 0 {
+			item.Author = jsonItem.Authors[0].Name
+		} else if jsonItem.Author != nil {
+			item.Author = jsonItem.Author.Name
+		}
+		for _, attachment := range jsonItem.Attachments {
+			enclosure := RSSEnclosure{
+				URL:      attachment.URL,
+				Type:     attachment.MimeType,
+				Duration: int(attachment.DurationInSeconds),
+				Image:    jsonItem.Image,
+			}
+			if attachment.SizeInBytes > 0 {
+				enclosure.Length = strconv.FormatInt(attachment.SizeInBytes, 10)
+			}
+			item.Enclosures = append(item.Enclosures, enclosure)
+		}
+		feed.Channel.Item = append(feed.Channel.Item, item)
+	}
+	return &feed
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// matches a well formed entity or character reference at the start of a slice
+var entityReference = regexp.MustCompile(`^&(#[0-9]+|#[xX][0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);`)
+
+var (
+	cdataStart = []byte("<![CDATA[")
+	cdataEnd   = []byte("]]>")
+)
+
+// cleans up the most common ways feeds break the XML rules before they are parsed leniently. Control
+// characters that XML doesn't allow are removed, and ampersands that don't start an entity are escaped.
+// CDATA sections are copied as they are, apart from the control characters, since an ampersand is
+// allowed in them. UTF-16 feeds are left alone as the bytes can't be checked one at a time
+func sanitizeFeed(body []byte) []byte {
+	if bytes.HasPrefix(body, utf16BEBOM) || bytes.HasPrefix(body, utf16LEBOM) {
+		return body
+	}
+	cleaned := make([]byte, 0, len(body))
+	inCDATA := false
+	for x := 0; x < len(body); x++ {
+		c := body[x]
+		switch {
+		case c < 0x20 && c != '\t' && c != '\n' && c != '\r':
+			continue
+		case !inCDATA && bytes.HasPrefix(body[x:], cdataStart):
+			inCDATA = true
+			cleaned = append(cleaned, cdataStart...)
+			x += len(cdataStart) - 1
+			continue
+		case inCDATA && bytes.HasPrefix(body[x:], cdataEnd):
+			inCDATA = false
+			cleaned = append(cleaned, cdataEnd...)
+			x += len(cdataEnd) - 1
+			continue
+		case !inCDATA && c == '&' && !entityReference.Match(body[x:]):
+			cleaned = append(cleaned, "&amp;"...)
+			continue
+		}
+		cleaned = append(cleaned, c)
+	}
+	return cleaned
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/lib/pq"
 
@@ -14,8 +17,11 @@ import (
 // a struct to hold the current state of the config file so we dont need to constantly
 // look it up
 type state struct {
-	db  *database.Queries
-	cfg *config.Config
+	db *database.Queries
+	// the connection behind db, for anything that needs a transaction
+	conn    *sql.DB
+	cfg     *config.Config
+	fetcher *fetcher
 }
 
 func main() {
@@ -30,16 +36,50 @@ func main() {
 	checkError(err)
 
 	currentState.db = database.New(db)
+	currentState.conn = db
+	currentState.fetcher, err = newFetcher(myConfig)
+	checkError(err)
 	commands := registerCommands()
 
 	inputs := os.Args
 	if len(inputs) < 2 {
 		checkError(fmt.Errorf("Error: not enough arguments were provided"))
 	}
-	err = commands.run(&currentState, command{name: inputs[1], arguments: inputs[2:]})
+	// cancelled when the process is interrupted, so long running commands can stop cleanly. Once it is
+	// cancelled the signals are let through again, so interrupting a second time stops gator straight away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	err = commands.run(ctx, &currentState, command{name: inputs[1], arguments: inputs[2:]})
 	checkError((err))
 }
 
+// reads the config file again and rebuilds the fetcher from it, keeping the old config if it can't be
+// read or any of its settings are invalid. The new fetcher keeps the old one's host limiter, so hosts
+// that asked us to back off are still left alone and robots.txt files aren't fetched again. The database
+// connection isn't reopened and the WebSub listener isn't restarted, so changes to db_url,
+// websub_callback and websub_listen need a restart
+func reloadConfig(s *state) {
+	myConfig, err := config.Read()
+	if err == nil {
+		_, err = parseScrapeSettings(myConfig, 0)
+	}
+	if err != nil {
+		fmt.Printf("Could not reload the config file: %v\n", err)
+		return
+	}
+	reloaded, err := newFetcher(myConfig)
+	if err != nil {
+		fmt.Printf("Could not reload the config file: %v\n", err)
+		return
+	}
+	s.fetcher.hosts.setLimits(reloaded.hosts.spacing, reloaded.hosts.concurrency)
+	reloaded.hosts = s.fetcher.hosts
+	s.cfg = &myConfig
+	s.fetcher = reloaded
+	fmt.Println("Config file reloaded")
+}
+
 // got sick of writing the error check every time
 func checkError(err error) {
 	if err != nil {
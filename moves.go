@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// works out whether a feed has moved, either through permanent redirects or because the feed says it now
+// lives somewhere else, and moves it if so. Temporary redirects are only logged. Returns the feed the
+// fetched posts should be saved against, which is a different feed if this one was merged into it
+func followFeedMove(ctx context.Context, s *state, feed database.Feed, rssFeed *RSSFeed, cache feedCache) (database.Feed, error) {
+	if cache.RedirectedTo != "" {
+		fmt.Printf("%v was temporarily redirected to %v, keeping %v\n", feed.Name, cache.RedirectedTo, feed.Url)
+	}
+	newURL := cache.MovedTo
+	if newURL == "" && rssFeed != nil {
+		declared := rssFeed.declaredURL(feed.Url)
+		if declared != "" && declared != feed.Url {
+			confirmed, err := s.fetcher.confirmFeedURL(ctx, declared)
+			if err != nil {
+				fmt.Printf("%v says it has moved to %v, but it couldn't be confirmed: %v\n", feed.Name, declared, err)
+				return feed, nil
+			}
+			newURL = confirmed
+		}
+	}
+	if newURL == "" || newURL == feed.Url {
+		return feed, nil
+	}
+	return moveFeed(ctx, s, feed, newURL)
+}
+
+// returns the address a feed says it lives at, from itunes:new-feed-url or failing that its self link.
+// Relative addresses are resolved against the URL the feed was fetched from
+func (f *RSSFeed) declaredURL(base string) string {
+	if newFeedURL := strings.TrimSpace(f.Channel.ITunesNewFeedURL); newFeedURL != "" {
+		return resolveLink(base, newFeedURL)
+	}
+	return feedLink(f, "self", base)
+}
+
+// checks that the address a feed says it lives at really has the feed before it is moved there. The
+// address is fetched, following any permanent redirects, and is only accepted if it parses as a feed and
+// that feed doesn't say it lives somewhere else again. Returns the confirmed address
+func (f *fetcher) confirmFeedURL(ctx context.Context, declared string) (string, error) {
+	feed, cache, err := f.fetchFeed(ctx, declared, feedCache{})
+	if err != nil {
+		return "", err
+	}
+	confirmed := declared
+	if cache.MovedTo != "" {
+		confirmed = cache.MovedTo
+	}
+	if feed != nil {
+		again := feed.declaredURL(confirmed)
+		if again != "" && again != declared && again != confirmed {
+			return "", fmt.Errorf("the feed at %v says it lives at %v", confirmed, again)
+		}
+	}
+	return confirmed, nil
+}
+
+// changes a feed's URL, keeping the old one in feed_url_history so follow and unfollow still find it. If
+// another feed already has the new URL the two are the same feed, so this feed's follows, posts and
+// history are merged into the other one and this one is deleted. Returns the feed that now has the URL
+func moveFeed(ctx context.Context, s *state, feed database.Feed, newURL string) (database.Feed, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return feed, err
+	}
+	defer tx.Rollback()
+	q := s.db.WithTx(tx)
+
+	existing, err := q.GetFeedsByURL(ctx, newURL)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return feed, err
+	}
+	merge := err == nil && existing.ID != feed.ID && existing.Url == newURL
+	target := feed
+	if merge {
+		target = existing
+		err = q.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{ToFeedID: existing.ID, FromFeedID: feed.ID})
+		if err != nil {
+			return feed, err
+		}
+		err = q.MovePosts(ctx, database.MovePostsParams{ToFeedID: existing.ID, FromFeedID: feed.ID})
+		if err != nil {
+			return feed, err
+		}
+		err = q.MoveFeedURLHistory(ctx, database.MoveFeedURLHistoryParams{ToFeedID: existing.ID, FromFeedID: feed.ID})
+		if err != nil {
+			return feed, err
+		}
+		err = q.DeleteFeed(ctx, feed.ID)
+	} else {
+		target.Url = newURL
+		err = q.SetFeedURL(ctx, database.SetFeedURLParams{ID: feed.ID, Url: newURL})
+	}
+	if err != nil {
+		return feed, err
+	}
+	err = q.AddFeedURLHistory(ctx, database.AddFeedURLHistoryParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		FeedID:    target.ID,
+		Url:       feed.Url,
+	})
+	if err != nil {
+		return feed, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return feed, err
+	}
+	if merge {
+		fmt.Printf("%v has moved to %v, which is %v, so the two feeds have been merged\n", feed.Name, newURL, existing.Name)
+	} else {
+		fmt.Printf("%v has moved permanently from %v to %v\n", feed.Name, feed.Url, newURL)
+	}
+	return target, nil
+}
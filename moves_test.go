@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDeclaredURL checks that the address a feed says it lives at is read from each format
+func TestDeclaredURL(t *testing.T) {
+	cases := []struct {
+		testName string
+		body     string
+		expect   string
+		link     string
+	}{
+		{
+			testName: "rss self link",
+			body:     `<rss xmlns:atom="http://www.w3.org/2005/Atom"><channel><atom:link href="/feed.xml" rel="self"/><link>https://example.com/</link></channel></rss>`,
+			expect:   "https://example.com/feed.xml",
+			link:     "https://example.com/",
+		},
+		{
+			testName: "itunes new feed url",
+			body:     `<rss xmlns:atom="http://www.w3.org/2005/Atom" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><link>https://example.com/</link><atom:link href="https://example.com/old" rel="self"/><itunes:new-feed-url>https://podcasts.example.org/show</itunes:new-feed-url></channel></rss>`,
+			expect:   "https://podcasts.example.org/show",
+			link:     "https://example.com/",
+		},
+		{
+			testName: "atom self link",
+			body:     `<feed xmlns="http://www.w3.org/2005/Atom"><link href="https://example.com/"/><link rel="self" href="https://example.com/atom"/></feed>`,
+			expect:   "https://example.com/atom",
+			link:     "https://example.com/",
+		},
+		{
+			testName: "json feed url",
+			body:     `{"version": "https://jsonfeed.org/version/1.1", "home_page_url": "https://example.com/", "feed_url": "https://example.com/feed.json", "items": []}`,
+			expect:   "https://example.com/feed.json",
+			link:     "https://example.com/",
+		},
+		{
+			testName: "no self link",
+			body:     `<rss><channel><link>https://example.com/</link></channel></rss>`,
+			link:     "https://example.com/",
+		},
+	}
+	for _, c := range cases {
+		feed, err := parseFeed([]byte(c.body), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := feed.declaredURL("https://example.com/rss")
+		if got != c.expect {
+			t.Errorf("Error testing %v: expected %q but got %q", c.testName, c.expect, got)
+		}
+		if feed.Channel.Link != c.link {
+			t.Errorf("Error testing %v: expected the link %q but got %q", c.testName, c.link, feed.Channel.Link)
+		}
+	}
+}
+
+// TestConfirmFeedURL checks that a declared address is only accepted when it really has the feed
+func TestConfirmFeedURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed", http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss><channel><title>Blog</title></channel></rss>`))
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><itunes:new-feed-url>https://example.com/other</itunes:new-feed-url></channel></rss>`))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>not a feed</body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := testFetcher(t)
+	cases := []struct {
+		testName string
+		path     string
+		expect   string
+	}{
+		{testName: "redirected", path: "/moved", expect: server.URL + "/feed"},
+		{testName: "points elsewhere", path: "/elsewhere"},
+		{testName: "not a feed", path: "/page"},
+	}
+	for _, c := range cases {
+		got, err := f.confirmFeedURL(context.Background(), server.URL+c.path)
+		if c.expect == "" && err == nil {
+			t.Errorf("Error testing %v: expected an error but got %v", c.testName, got)
+		}
+		if got != c.expect {
+			t.Errorf("Error testing %v: expected %q but got %q", c.testName, c.expect, got)
+		}
+	}
+}
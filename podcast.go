@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// Media RSS elements, used by podcasts and video sites to describe the files attached to an item
+type MediaContent struct {
+	URL       string `xml:"url,attr"`
+	Type      string `xml:"type,attr"`
+	FileSize  string `xml:"fileSize,attr"`
+	Duration  string `xml:"duration,attr"`
+	IsDefault string `xml:"isDefault,attr"`
+}
+
+type MediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+// a media:group holds several versions of the same media, like different bitrates of a video
+type MediaGroup struct {
+	Contents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// returns the version of the media in a group to keep: the one marked isDefault, otherwise the biggest.
+// The other versions are the same media, so only one of them is kept as an enclosure
+func (group MediaGroup) preferred() (MediaContent, bool) {
+	var best MediaContent
+	var bestSize int64 = -1
+	for _, content := range group.Contents {
+		if content.URL == "" {
+			continue
+		}
+		if content.IsDefault == "true" {
+			return content, true
+		}
+		size, err := strconv.ParseInt(content.FileSize, 10, 64)
+		if err != nil {
+			size = 0
+		}
+		if size > bestSize {
+			best, bestSize = content, size
+		}
+	}
+	return best, bestSize >= 0
+}
+
+// merges the media:content elements into the item's enclosures and fills in the duration and image
+// from the iTunes and Media RSS elements, so everything we know about the files ends up in one place.
+// Each media:group adds a single enclosure, its preferred version
+func (item *RSSItem) collectMedia() {
+	contents := item.MediaContents
+	thumbnails := item.MediaThumbnails
+	for _, group := range item.MediaGroups {
+		if content, ok := group.preferred(); ok {
+			contents = append(contents, content)
+		}
+		thumbnails = append(thumbnails, group.Thumbnails...)
+	}
+	for _, content := range contents {
+		if content.URL == "" || item.hasEnclosure(content.URL) {
+			continue
+		}
+		duration, _ := strconv.Atoi(content.Duration)
+		item.Enclosures = append(item.Enclosures, RSSEnclosure{
+			URL:      content.URL,
+			Type:     content.Type,
+			Length:   content.FileSize,
+			Duration: duration,
+		})
+	}
+	image := item.ITunesImage.Href
+	if image == "" && len(thumbnails) > 0 {
+		image = thumbnails[0].URL
+	}
+	duration := parseITunesDuration(item.ITunesDuration)
+	for x := range item.Enclosures {
+		if item.Enclosures[x].Duration == 0 {
+			item.Enclosures[x].Duration = duration
+		}
+		if item.Enclosures[x].Image == "" {
+			item.Enclosures[x].Image = image
+		}
+	}
+}
+
+// reports whether the item already has an enclosure with the given URL
+func (item *RSSItem) hasEnclosure(enclosureURL string) bool {
+	for _, enclosure := range item.Enclosures {
+		if enclosure.URL == enclosureURL {
+			return true
+		}
+	}
+	return false
+}
+
+// converts an itunes:duration into seconds. It can be a number of seconds, or MM:SS or HH:MM:SS.
+// Durations that can't be read are returned as 0
+func parseITunesDuration(duration string) int {
+	parts := strings.Split(strings.TrimSpace(duration), ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	seconds := 0
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0
+		}
+		seconds = seconds*60 + int(value)
+	}
+	return seconds
+}
+
+// saves the enclosures of an item against the post that was created for it
+func saveEnclosures(ctx context.Context, s *state, postID uuid.UUID, enclosures []RSSEnclosure) error {
+	for _, enclosure := range enclosures {
+		if enclosure.URL == "" {
+			continue
+		}
+		length, parseErr := strconv.ParseInt(enclosure.Length, 10, 64)
+		err := s.db.CreateEnclosure(ctx, database.CreateEnclosureParams{
+			ID:              uuid.New(),
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+			PostID:          postID,
+			Url:             enclosure.URL,
+			MimeType:        enclosure.Type,
+			Length:          sql.NullInt64{Int64: length, Valid: parseErr == nil && length > 0},
+			DurationSeconds: sql.NullInt32{Int32: int32(enclosure.Duration), Valid: enclosure.Duration > 0},
+			ImageUrl:        sql.NullString{String: enclosure.Image, Valid: enclosure.Image != ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formats an enclosure for browse, e.g. "audio/mpeg 42m10s https://example.com/episode.mp3"
+func describeEnclosure(enclosure database.Enclosure) string {
+	description := enclosure.MimeType
+	if enclosure.DurationSeconds.Valid {
+		duration := time.Duration(enclosure.DurationSeconds.Int32) * time.Second
+		description += fmt.Sprintf(" %v", duration)
+	}
+	return strings.TrimSpace(description + " " + enclosure.Url)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseITunesDuration checks the duration formats allowed by the iTunes namespace
+func TestParseITunesDuration(t *testing.T) {
+	tests := map[string]int{
+		"3723":     3723,
+		"62:03":    3723,
+		"1:02:03":  3723,
+		"01:02:03": 3723,
+		"90.5":     90,
+		"":         0,
+		"1:2:3:4":  0,
+		"an hour":  0,
+	}
+	for duration, expect := range tests {
+		got := parseITunesDuration(duration)
+		if got != expect {
+			t.Errorf("Error testing %q: expected %v but got %v", duration, expect, got)
+		}
+	}
+}
+
+// TestParseFeedPodcast checks that enclosures pick up media:content, durations and images, and that only
+// one version from each media:group is kept
+func TestParseFeedPodcast(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/">
+<channel><title>Podcast</title>
+<item><title>Episode 1</title>
+<enclosure url="https://example.com/1.mp3" type="audio/mpeg" length="1024"/>
+<media:content url="https://example.com/1.mp3" type="audio/mpeg" fileSize="1024"/>
+<media:group><media:content url="https://example.com/1-low.mp4" type="video/mp4" fileSize="1000" duration="3600"/>
+<media:content url="https://example.com/1.mp4" type="video/mp4" fileSize="5000" duration="3600"/>
+<media:content url="https://example.com/1-mid.mp4" type="video/mp4" fileSize="3000" duration="3600"/></media:group>
+<media:group><media:content url="https://example.com/1-hd.webm" type="video/webm" fileSize="9000"/>
+<media:content url="https://example.com/1.webm" type="video/webm" fileSize="4000" isDefault="true"/></media:group>
+<media:thumbnail url="https://example.com/thumb.jpg"/>
+<itunes:duration>42:10</itunes:duration>
+<itunes:image href="https://example.com/1.jpg"/>
+</item></channel></rss>`
+	expect := []RSSEnclosure{
+		{URL: "https://example.com/1.mp3", Type: "audio/mpeg", Length: "1024", Duration: 2530, Image: "https://example.com/1.jpg"},
+		{URL: "https://example.com/1.mp4", Type: "video/mp4", Length: "5000", Duration: 3600, Image: "https://example.com/1.jpg"},
+		{URL: "https://example.com/1.webm", Type: "video/webm", Length: "4000", Duration: 2530, Image: "https://example.com/1.jpg"},
+	}
+
+	got, err := parseFeed([]byte(body), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Channel.Item[0].Enclosures, expect) {
+		t.Errorf("Error testing podcast enclosures: expected %v but got %v", expect, got.Channel.Item[0].Enclosures)
+	}
+}
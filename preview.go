@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// the names of the formats parseFeed understands, keyed by their root element
+var feedFormats = map[string]string{
+	"rss":  "RSS 2.0",
+	"feed": "Atom",
+	"RDF":  "RSS 1.0 (RDF)",
+}
+
+// names the format of a feed the same way parseFeed decides how to parse it
+func feedFormat(body []byte, contentType string) string {
+	body = bytes.TrimPrefix(body, utf8BOM)
+	if isJSONFeed(body, contentType) {
+		return "JSON Feed"
+	}
+	root, err := rootElement(sanitizeFeed(body), contentType, true)
+	if err != nil {
+		return "unknown"
+	}
+	if format, ok := feedFormats[root.Local]; ok {
+		return format
+	}
+	return fmt.Sprintf("unknown (<%v>)", root.Local)
+}
+
+// reads a feed from a local file or fetches it from a URL, returning the body and its content type. A
+// file's content type is guessed from its extension. Anything that isn't an existing file is fetched
+// through the fetcher, with the same limits and policy as agg, and any redirects are printed
+func loadFeedSource(ctx context.Context, w io.Writer, f *fetcher, source string) ([]byte, string, error) {
+	if info, err := os.Stat(source); err == nil && !info.IsDir() {
+		body, err := os.ReadFile(source)
+		return body, mime.TypeByExtension(filepath.Ext(source)), err
+	}
+	response, err := f.fetchConditional(ctx, source, feedCache{})
+	if err != nil {
+		return nil, "", err
+	}
+	if response.movedTo != "" {
+		fmt.Fprintf(w, "Moved permanently to: %v\n", response.movedTo)
+	}
+	if response.redirectedTo != "" {
+		fmt.Fprintf(w, "Redirected temporarily to: %v\n", response.redirectedTo)
+	}
+	return response.body, response.contentType, nil
+}
+
+// prints what gator extracts from a feed: its format, channel details, scheduling hints, any warnings
+// from parsing and the first limit items with their parsed dates. Nothing is saved
+func printFeedPreview(w io.Writer, source string, body []byte, contentType string, limit int) error {
+	fmt.Fprintf(w, "Format: %v\n", feedFormat(body, contentType))
+	if contentType != "" {
+		fmt.Fprintf(w, "Content-Type: %v\n", contentType)
+	}
+	feed, err := parseFetchedFeed(body, contentType)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Title: %v\n", feed.Channel.Title)
+	fmt.Fprintf(w, "Link: %v\n", feed.Channel.Link)
+	if feed.Channel.Description != "" {
+		fmt.Fprintf(w, "Description: %v\n", feed.Channel.Description)
+	}
+	if declared := feed.declaredURL(source); declared != "" && declared != source {
+		fmt.Fprintf(w, "Says it lives at: %v\n", declared)
+	}
+	if hub := feedLink(feed, "hub", source); hub != "" {
+		fmt.Fprintf(w, "WebSub hub: %v\n", hub)
+	}
+	hints := feedRefreshHints(feed, feedCache{})
+	if hints.ttl > 0 {
+		fmt.Fprintf(w, "Refresh no more than every: %v\n", hints.ttl)
+	}
+	if len(feed.Channel.SkipHours) > 0 || len(feed.Channel.SkipDays) > 0 {
+		fmt.Fprintf(w, "Skip hours: %v, skip days: %v\n", strings.Join(feed.Channel.SkipHours, " "), strings.Join(feed.Channel.SkipDays, " "))
+	}
+	for _, warning := range feed.Warnings {
+		fmt.Fprintf(w, "Warning: %v\n", warning)
+	}
+	fmt.Fprintf(w, "Items: %v\n", len(feed.Channel.Item))
+
+	now := time.Now()
+	for x, item := range feed.Channel.Item {
+		if x == limit {
+			fmt.Fprintf(w, "\n...and %v more\n", len(feed.Channel.Item)-limit)
+			break
+		}
+		fmt.Fprintf(w, "\n%v. %v\n", x+1, item.Title)
+		fmt.Fprintf(w, "   Link: %v\n", item.Link)
+		published, err := parsePubDate(item.PubDate, now)
+		if err != nil {
+			fmt.Fprintf(w, "   Published: %q could not be parsed (%v)\n", item.PubDate, err)
+		} else {
+			fmt.Fprintf(w, "   Published: %v (from %q)\n", published.Format(time.RFC1123Z), item.PubDate)
+		}
+		if item.Author != "" {
+			fmt.Fprintf(w, "   Author: %v\n", item.Author)
+		}
+		if item.GUID.Value != "" {
+			fmt.Fprintf(w, "   GUID: %v (permalink: %v)\n", item.GUID.Value, item.GUID.permalink())
+		}
+		if len(item.Categories) > 0 {
+			fmt.Fprintf(w, "   Categories: %v\n", strings.Join(item.Categories, ", "))
+		}
+		for _, enclosure := range item.Enclosures {
+			fmt.Fprintf(w, "   Enclosure: %v %v\n", enclosure.Type, enclosure.URL)
+		}
+	}
+	return nil
+}
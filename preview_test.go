@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const previewFeed = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><title>Blog</title>
+<link>https://example.com/</link><ttl>60</ttl>
+<atom:link href="https://hub.example.com/" rel="hub"/>
+<item><title>First</title><link>https://example.com/1</link><pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate></item>
+<item><title>Second</title><link>https://example.com/2</link><pubDate>sometime</pubDate></item>
+<item><title>Third</title><link>https://example.com/3</link></item>
+</channel></rss>`
+
+// TestFeedFormat checks that each supported format is named
+func TestFeedFormat(t *testing.T) {
+	cases := []struct {
+		testName    string
+		body        string
+		contentType string
+		expect      string
+	}{
+		{testName: "rss 2.0", body: previewFeed, expect: "RSS 2.0"},
+		{testName: "atom", body: `<feed xmlns="http://www.w3.org/2005/Atom"></feed>`, expect: "Atom"},
+		{testName: "rdf", body: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"></rdf:RDF>`, expect: "RSS 1.0 (RDF)"},
+		{testName: "json feed", body: `{"version": "https://jsonfeed.org/version/1.1", "items": []}`, contentType: "application/feed+json", expect: "JSON Feed"},
+		{testName: "html", body: `<html></html>`, expect: "unknown (<html>)"},
+	}
+	for _, c := range cases {
+		actual := feedFormat([]byte(c.body), c.contentType)
+		if actual != c.expect {
+			t.Errorf("Error testing %v: expected %v but got %v", c.testName, c.expect, actual)
+		}
+	}
+}
+
+// TestPrintFeedPreview checks the preview shows the channel, each item's parsed date and stops at the limit
+func TestPrintFeedPreview(t *testing.T) {
+	var out bytes.Buffer
+	err := printFeedPreview(&out, "https://example.com/feed.xml", []byte(previewFeed), "application/rss+xml", 2)
+	if err != nil {
+		t.Fatalf("Error testing preview: expected no error but got %v", err)
+	}
+	for _, expect := range []string{
+		"Format: RSS 2.0",
+		"Title: Blog",
+		"WebSub hub: https://hub.example.com/",
+		"Refresh no more than every: 1h0m0s",
+		"Items: 3",
+		"1. First",
+		"Published: Mon, 02 Jan 2006 15:04:05 +0000",
+		`Published: "sometime" could not be parsed`,
+		"...and 1 more",
+	} {
+		if !strings.Contains(out.String(), expect) {
+			t.Errorf("Error testing preview: expected output to contain %q but got\n%v", expect, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Third") {
+		t.Errorf("Error testing preview: expected only 2 items but got\n%v", out.String())
+	}
+}
+
+// TestLoadFeedSource checks that feeds are read from local files as well as URLs
+func TestLoadFeedSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	body, contentType, err := loadFeedSource(context.Background(), &bytes.Buffer{}, testFetcher(t), path)
+	if err != nil || string(body) != `{}` || contentType != "application/json" {
+		t.Errorf("Error testing local file: expected {} as application/json but got %q as %v (%v)", body, contentType, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(previewFeed))
+	}))
+	defer server.Close()
+	body, contentType, err = loadFeedSource(context.Background(), &bytes.Buffer{}, testFetcher(t), server.URL+"/feed.xml")
+	if err != nil || string(body) != previewFeed || contentType != "application/rss+xml" {
+		t.Errorf("Error testing url: expected the feed as application/rss+xml but got %q as %v (%v)", body, contentType, err)
+	}
+}
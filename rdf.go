@@ -0,0 +1,54 @@
+package main
+
+// the RDFFeed struct represents an RSS 1.0 document. Unlike RSS 2.0 the items are not inside the
+// channel element, they are siblings of it under the <rdf:RDF> root
+type RDFFeed struct {
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		Description     string `xml:"description"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Items []RDFItem `xml:"item"`
+}
+
+// dates and authors come from the Dublin Core namespace rather than RSS elements
+type RDFItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subjects    []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+// converts the RDF feed into the RSSFeed struct used by scrapeFeeds. The rdf:about attribute is the
+// item's URI so it is used as the guid, and as the link if the item doesn't have one
+func (r RDFFeed) toRSSFeed() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = r.Channel.Title
+	feed.Channel.Link = r.Channel.Link
+	feed.Channel.Description = r.Channel.Description
+	feed.Channel.UpdatePeriod = r.Channel.UpdatePeriod
+	feed.Channel.UpdateFrequency = r.Channel.UpdateFrequency
+	for _, rdfItem := range r.Items {
+		item := RSSItem{
+			Title:       rdfItem.Title,
+			Link:        rdfItem.Link,
+			Description: rdfItem.Description,
+			PubDate:     rdfItem.Date,
+			Content:     rdfItem.Content,
+			Author:      rdfItem.Creator,
+			GUID:        RSSGUID{Value: rdfItem.About, IsPermaLink: "true"},
+			Categories:  rdfItem.Subjects,
+		}
+		if item.Link == "" {
+			item.Link = rdfItem.About
+		}
+		feed.Channel.Item = append(feed.Channel.Item, item)
+	}
+	return &feed
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the user agent token we look for in robots.txt files
+const robotsUserAgent = "gator"
+
+// how long a host's robots.txt is cached for, and how long we wait to try again when it couldn't be
+// fetched
+const (
+	robotsCacheTime      = 24 * time.Hour
+	robotsErrorCacheTime = time.Hour
+)
+
+// robots.txt files bigger than this are cut off, which is what the major crawlers do too
+const maxRobotsSize = 500 * 1024
+
+// the rules from a robots.txt file that apply to gator
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// checks that the host's robots.txt allows gator to fetch a URL, fetching and caching the robots.txt
+// if we don't have it already. If the robots.txt is missing everything is allowed, but if the server
+// errors nothing is until it has had a chance to recover
+func (f *fetcher) checkRobots(ctx context.Context, target *url.URL) error {
+	rules, expiry, ok := f.hosts.cachedRobots(target.Host)
+	if !ok {
+		rules, expiry = f.fetchRobots(ctx, target)
+		f.hosts.cacheRobots(target.Host, rules, expiry)
+	}
+	if !rules.allowed(target.RequestURI()) {
+		// the rules might be different once they expire, so that's when it's worth asking again
+		return &waitError{
+			reason:  errRobotsDisallowed,
+			until:   expiry,
+			message: fmt.Sprintf("%v does not allow %v to fetch %v", target.Host, robotsUserAgent, target.RequestURI()),
+		}
+	}
+	return nil
+}
+
+// fetches and parses the robots.txt for the host of a URL, returning the rules and when they expire
+func (f *fetcher) fetchRobots(ctx context.Context, target *url.URL) (robotsRules, time.Time) {
+	robotsURL := url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/robots.txt"}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return robotsRules{}, time.Now().Add(robotsErrorCacheTime)
+	}
+	request.Header.Set("User-Agent", f.userAgent)
+	response, err := f.client.Do(request)
+	if err != nil {
+		return robotsRules{}, time.Now().Add(robotsErrorCacheTime)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 500 {
+		// the host might have a robots.txt it can't serve right now, so assume it disallows everything
+		return robotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}, time.Now().Add(robotsErrorCacheTime)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return robotsRules{}, time.Now().Add(robotsCacheTime)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxRobotsSize))
+	if err != nil {
+		return robotsRules{}, time.Now().Add(robotsErrorCacheTime)
+	}
+	return parseRobots(body, robotsUserAgent), time.Now().Add(robotsCacheTime)
+}
+
+// parses a robots.txt file, keeping the rules from the group for our user agent. If there isn't a group
+// for us the rules for * are used instead
+func parseRobots(body []byte, userAgent string) robotsRules {
+	var ours, everyone robotsRules
+	foundOurs := false
+	var current []*robotsRules
+	inAgents := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			// consecutive user-agent lines share the rules that follow them
+			if !inAgents {
+				current = nil
+				inAgents = true
+			}
+			agent := strings.ToLower(value)
+			if agent == "*" {
+				current = append(current, &everyone)
+			} else if agent != "" && strings.Contains(strings.ToLower(userAgent), agent) {
+				current = append(current, &ours)
+				foundOurs = true
+			}
+		case "allow", "disallow":
+			inAgents = false
+			if value == "" {
+				continue
+			}
+			for _, rules := range current {
+				rules.rules = append(rules.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			inAgents = false
+			delay, err := strconv.ParseFloat(value, 64)
+			if err != nil || delay < 0 {
+				continue
+			}
+			for _, rules := range current {
+				rules.crawlDelay = time.Duration(delay * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+	if foundOurs {
+		return ours
+	}
+	return everyone
+}
+
+// reports whether a path is allowed. The longest matching rule wins, and allow wins a tie
+func (r robotsRules) allowed(path string) bool {
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsPatternMatches(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// matches a robots.txt path pattern, where * matches anything and a trailing $ anchors the end
+func robotsPatternMatches(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	position := len(parts[0])
+	for _, part := range parts[1:] {
+		index := strings.Index(path[position:], part)
+		if index < 0 {
+			return false
+		}
+		position += index + len(part)
+	}
+	if !anchored {
+		return true
+	}
+	if len(parts) > 1 && parts[len(parts)-1] == "" {
+		return true
+	}
+	if len(parts) == 1 {
+		return position == len(path)
+	}
+	return strings.HasSuffix(path, parts[len(parts)-1])
+}
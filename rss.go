@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"encoding/xml"
-	"html"
-	"io"
-	"net/http"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ben-smith-404/blog-aggregator/internal/database"
@@ -14,63 +16,332 @@ import (
 
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Title string `xml:"title"`
+		// atom:link has to come before link, otherwise link would match it as well
+		AtomLinks   []AtomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Link        string     `xml:"link"`
+		Description string     `xml:"description"`
+		Item        []RSSItem  `xml:"item"`
+		// hints from the publisher about how often the feed is worth fetching
+		TTL             string   `xml:"ttl"`
+		UpdatePeriod    string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		SkipHours       []string `xml:"skipHours>hour"`
+		SkipDays        []string `xml:"skipDays>day"`
+		// podcasts that move announce their new address with this tag
+		ITunesNewFeedURL string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd new-feed-url"`
 	} `xml:"channel"`
+	// problems found while parsing that didn't stop the feed being read
+	Warnings []string `xml:"-"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string         `xml:"pubDate"`
+	DCDate      string         `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      string         `xml:"author"`
+	Creator     string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	GUID        RSSGUID        `xml:"guid"`
+	Categories  []string       `xml:"category"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+	// podcast and video feeds describe their files with the Media RSS and iTunes namespaces
+	MediaContents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroups     []MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+	ITunesDuration  string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesImage     ITunesImage      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
 }
 
-// fetches a feed from a given URL
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	client := &http.Client{}
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
-	checkError(err)
-	request.Header.Set("User-Agent", "gator")
-	response, err := client.Do(request)
-	checkError(err)
-	body, err := io.ReadAll(response.Body)
-	checkError(err)
-	var feed RSSFeed
-	err = xml.Unmarshal(body, &feed)
-	checkError(err)
-	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
-	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
-
-	for x, rssItem := range feed.Channel.Item {
-		rssItem.Title = html.UnescapeString(rssItem.Title)
-		rssItem.Description = html.UnescapeString(rssItem.Description)
-		feed.Channel.Item[x] = rssItem
-	}
-	return &feed, nil
+// an RSS guid is a permalink to the item unless the isPermaLink attribute says otherwise
+type RSSGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
 }
 
-// the almighty feed scraper. Gets the oldest feed in the db, retrieves the feed info using fetchFeed()
-// and saves them to the database in the posts table
-func scrapeFeeds(s *state) {
-	feed, err := s.db.GetNextFeedToFetch(context.Background())
-	checkError(err)
-	err = s.db.MarkFeedFetched(context.Background(), feed.ID)
-	checkError(err)
-	rssFeed, err := fetchFeed(context.Background(), feed.Url)
-	checkError(err)
+// reports whether the guid can be used as a link to the item
+func (g RSSGUID) permalink() bool {
+	return g.Value != "" && g.IsPermaLink != "false"
+}
+
+// returns the item's categories, never nil. A nil slice is sent to the database as NULL, which the
+// NOT NULL categories column rejects rather than using its default
+func (item RSSItem) categoryList() []string {
+	if item.Categories == nil {
+		return []string{}
+	}
+	return item.Categories
+}
+
+// an enclosure is a file attached to an item, like a podcast episode. The duration, in seconds, and the
+// image aren't part of the enclosure element so they are filled in from the rest of the item
+type RSSEnclosure struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Length   string `xml:"length,attr"`
+	Duration int    `xml:"-"`
+	Image    string `xml:"-"`
+}
+
+// parses the body of a feed into an RSSFeed. JSON feeds are picked out by their content type or by
+// starting with a {, otherwise the format is worked out from the root element of the document, <rss>
+// for RSS 2.0, <feed> for Atom and <rdf:RDF> for RSS 1.0. If the XML is broken the feed is parsed again
+// leniently, and whatever could be salvaged is returned with a warning explaining what went wrong
+func parseFeed(body []byte, contentType string) (*RSSFeed, error) {
+	body = bytes.TrimPrefix(body, utf8BOM)
+	if isJSONFeed(body, contentType) {
+		return parseJSONFeed(body)
+	}
+	feed, err := decodeFeed(body, contentType, false)
+	if err == nil {
+		return feed, nil
+	}
+	feed, lenientErr := decodeFeed(sanitizeFeed(body), contentType, true)
+	if lenientErr != nil {
+		return nil, err
+	}
+	feed.Warnings = append([]string{fmt.Sprintf("the feed is malformed and was parsed leniently: %v", err)}, feed.Warnings...)
+	return feed, nil
+}
+
+// decodes an xml feed in whichever format its root element says it is. In lenient mode a feed that
+// stops part way through keeps the items read before the error, as long as there is at least one
+func decodeFeed(body []byte, contentType string, lenient bool) (*RSSFeed, error) {
+	root, err := rootElement(body, contentType, lenient)
+	if err != nil {
+		return nil, err
+	}
+	var feed *RSSFeed
+	switch root.Local {
+	case "rss":
+		var rssFeed RSSFeed
+		err = newFeedDecoder(body, contentType, lenient).Decode(&rssFeed)
+		// some RSS 2.0 feeds use the Dublin Core elements instead of pubDate and author, and some
+		// only link to the item through a permalink guid
+		for x, rssItem := range rssFeed.Channel.Item {
+			if rssItem.PubDate == "" {
+				rssFeed.Channel.Item[x].PubDate = rssItem.DCDate
+			}
+			if rssItem.Author == "" {
+				rssFeed.Channel.Item[x].Author = rssItem.Creator
+			}
+			if rssItem.Link == "" && rssItem.GUID.permalink() {
+				rssFeed.Channel.Item[x].Link = rssItem.GUID.Value
+			}
+			rssFeed.Channel.Item[x].collectMedia()
+		}
+		feed = &rssFeed
+	case "feed":
+		var atomFeed AtomFeed
+		err = newFeedDecoder(body, contentType, lenient).Decode(&atomFeed)
+		feed = atomFeed.toRSSFeed()
+	case "RDF":
+		var rdfFeed RDFFeed
+		err = newFeedDecoder(body, contentType, lenient).Decode(&rdfFeed)
+		feed = rdfFeed.toRSSFeed()
+	default:
+		return nil, fmt.Errorf("unsupported feed format with root element <%v>", root.Local)
+	}
+	if err != nil {
+		if !lenient || len(feed.Channel.Item) == 0 {
+			return nil, err
+		}
+		feed.Warnings = append(feed.Warnings, fmt.Sprintf("only %v items could be read before the feed broke off: %v", len(feed.Channel.Item), err))
+	}
+	return feed, nil
+}
+
+// reports whether a feed should be parsed as JSON rather than XML
+func isJSONFeed(body []byte, contentType string) bool {
+	if strings.Contains(contentType, "json") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))
+}
+
+// returns the name of the first element in an xml document, skipping over the declaration, comments
+// and anything else that comes before it
+func rootElement(body []byte, contentType string, lenient bool) (xml.Name, error) {
+	decoder := newFeedDecoder(body, contentType, lenient)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, fmt.Errorf("could not find the root element of the feed: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// how many of a feed's items were saved as new posts, updated existing posts because they had been edited,
+// or were skipped because they were already saved as they are
+type savedItems struct {
+	saved      int
+	updated    int
+	duplicates int
+}
+
+// what came of scraping a feed
+type scrapeResult struct {
+	savedItems
+	// the feed the posts were saved against, which is a different feed if the scraped one moved to the
+	// address of a feed we already had and was merged into it
+	feed database.Feed
+	// the feed hadn't changed since it was last fetched
+	unchanged bool
+	hints     refreshHints
+	// the status of the response, the size of its body and the number of items in it
+	statusCode int
+	bytes      int
+	itemsSeen  int
+}
+
+// the almighty feed scraper. Retrieves the feed info for a single feed using fetchFeed() and saves them
+// to the database in the posts table. The context limits how long the whole scrape can take. Posts that
+// are already saved are skipped, any other post that can't be saved is reported in the returned error
+// once the rest of the feed has been saved, and the feed's cache details aren't updated so the next
+// fetch tries them again. If the feed has moved its URL is updated first, and if it advertises a WebSub
+// hub it is subscribed to. The result says what was saved and has the hints used to schedule the next
+// fetch
+func scrapeFeed(ctx context.Context, s *state, feed database.Feed) (scrapeResult, error) {
+	rssFeed, cache, err := s.fetcher.fetchFeed(ctx, feed.Url, feedCache{
+		ETag:         feed.Etag.String,
+		LastModified: feed.LastModified.String,
+		ContentHash:  feed.ContentHash.String,
+	})
+	if err != nil {
+		return scrapeResult{feed: feed}, err
+	}
+	moved, err := followFeedMove(ctx, s, feed, rssFeed, cache)
+	if err != nil {
+		return scrapeResult{feed: feed}, err
+	}
+	feed = moved
+	result := scrapeResult{
+		feed:       feed,
+		hints:      feedRefreshHints(rssFeed, cache),
+		statusCode: cache.StatusCode,
+		bytes:      cache.Bytes,
+	}
+	if rssFeed == nil {
+		fmt.Printf("%v has not changed since it was last fetched\n", feed.Name)
+		result.unchanged = true
+		return result, saveFeedCache(ctx, s, feed, cache)
+	}
+	result.itemsSeen = len(rssFeed.Channel.Item)
+	for _, warning := range rssFeed.Warnings {
+		fmt.Printf("Warning for %v: %v\n", feed.Name, warning)
+	}
+	err = s.db.SetFeedWarning(ctx, database.SetFeedWarningParams{
+		ID:          feed.ID,
+		LastWarning: sql.NullString{String: strings.Join(rssFeed.Warnings, "; "), Valid: len(rssFeed.Warnings) > 0},
+	})
+	if err != nil {
+		return scrapeResult{feed: feed}, err
+	}
+	result.savedItems, err = saveItems(ctx, s, feed, rssFeed)
+	if err == nil {
+		err = saveFeedCache(ctx, s, feed, cache)
+	}
+	if s.cfg.WebSubCallback != "" {
+		subscribeWebSub(ctx, s, feed, rssFeed)
+	}
+	return result, err
+}
+
+// saves the cache details from a fetch for the next one. This is only done once the feed's items have
+// all been saved, otherwise the next fetch would see an unchanged feed and skip the items that failed
+func saveFeedCache(ctx context.Context, s *state, feed database.Feed, cache feedCache) error {
+	return s.db.SetFeedCache(ctx, database.SetFeedCacheParams{
+		ID:           feed.ID,
+		Etag:         sql.NullString{String: cache.ETag, Valid: cache.ETag != ""},
+		LastModified: sql.NullString{String: cache.LastModified, Valid: cache.LastModified != ""},
+		ContentHash:  sql.NullString{String: cache.ContentHash, Valid: cache.ContentHash != ""},
+	})
+}
+
+// saves the items in a feed as posts, along with their enclosures, and returns how many were new, how
+// many were already saved but have since been edited and so were updated, and how many were already
+// saved. This is used for both fetched and pushed feeds. Items that can't be saved don't stop the rest,
+// they are reported together in the returned error. Posts are told apart by their url, so items with no
+// link (or permalink guid) are skipped rather than all being saved over one another
+func saveItems(ctx context.Context, s *state, feed database.Feed, rssFeed *RSSFeed) (savedItems, error) {
+	var items savedItems
+	var unparsedDates []string
+	var noLink []string
+	var saveErrors []error
 	for _, rssItem := range rssFeed.Channel.Item {
-		pubDate, _ := time.Parse(time.RFC1123Z, rssItem.PubDate)
-		err = s.db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
-			Title:       rssItem.Title,
-			Url:         rssItem.Link,
-			PublishedAt: pubDate,
-			FeedID:      feed.ID,
+		if rssItem.Link == "" {
+			noLink = append(noLink, rssItem.Title)
+			continue
+		}
+		firstSeen := time.Now()
+		pubDate, err := parsePubDate(rssItem.PubDate, firstSeen)
+		if err != nil {
+			unparsedDates = append(unparsedDates, fmt.Sprintf("%v (%v)", rssItem.Title, err))
+		}
+		postID, err := s.db.CreatePost(ctx, database.CreatePostParams{
+			ID:              uuid.New(),
+			CreatedAt:       firstSeen,
+			UpdatedAt:       firstSeen,
+			Title:           rssItem.Title,
+			Url:             rssItem.Link,
+			Description:     rssItem.Description,
+			PublishedAt:     pubDate,
+			FeedID:          feed.ID,
+			Content:         rssItem.Content,
+			Author:          rssItem.Author,
+			Guid:            rssItem.GUID.Value,
+			GuidIsPermalink: rssItem.GUID.permalink(),
+			Categories:      rssItem.categoryList(),
 		})
+		if isDuplicate(err) {
+			var updated int64
+			updated, err = s.db.UpdatePost(ctx, database.UpdatePostParams{
+				Url:         rssItem.Link,
+				FeedID:      feed.ID,
+				Title:       rssItem.Title,
+				Description: rssItem.Description,
+				Content:     rssItem.Content,
+				Author:      rssItem.Author,
+				Categories:  rssItem.categoryList(),
+			})
+			if err != nil {
+				saveErrors = append(saveErrors, fmt.Errorf("%v: %w", rssItem.Link, err))
+			} else if updated > 0 {
+				items.updated++
+			} else {
+				items.duplicates++
+			}
+			continue
+		}
+		if err == nil {
+			err = saveEnclosures(ctx, s, postID, rssItem.Enclosures)
+		}
+		if err != nil {
+			saveErrors = append(saveErrors, fmt.Errorf("%v: %w", rssItem.Link, err))
+			continue
+		}
+		items.saved++
+	}
+	if len(unparsedDates) > 0 {
+		fmt.Printf("%v items in %v had no usable publication date, the time they were first seen was used instead:\n", len(unparsedDates), feed.Name)
+		for _, item := range unparsedDates {
+			fmt.Printf(" * %v\n", item)
+		}
+	}
+	if len(noLink) > 0 {
+		fmt.Printf("%v items in %v had no link and were skipped:\n", len(noLink), feed.Name)
+		for _, title := range noLink {
+			fmt.Printf(" * %v\n", title)
+		}
+	}
+	fmt.Printf("%v: %v new posts saved, %v updated, %v already saved\n", feed.Name, items.saved, items.updated, items.duplicates)
+	if len(saveErrors) > 0 {
+		return items, fmt.Errorf("%w: %v of %v posts failed: %w", errSavePosts, len(saveErrors), len(rssFeed.Channel.Item), errors.Join(saveErrors...))
 	}
+	return items, nil
 }
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/lib/pq"
+)
+
+type testParseFeedStruct struct {
+	testName    string
+	body        string
+	contentType string
+	expect      RSSItem
+}
+
+// TestParseFeed checks that each supported format ends up as the same RSSItem
+func TestParseFeed(t *testing.T) {
+	tests := []testParseFeedStruct{
+		{
+			testName: "rss 2.0",
+			body: `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Blog</title>
+<item><title>Hello</title><link>https://example.com/hello</link><description>First post</description>
+<pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate></item>
+</channel></rss>`,
+			expect: RSSItem{
+				Title:       "Hello",
+				Link:        "https://example.com/hello",
+				Description: "First post",
+				PubDate:     "Mon, 02 Jan 2006 15:04:05 +0000",
+			},
+		},
+		{
+			testName: "rss 2.0 with extra metadata",
+			body: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/"
+ xmlns:dc="http://purl.org/dc/elements/1.1/"><channel><title>Blog</title>
+<item><title>Hello</title><description>First post</description>
+<content:encoded><![CDATA[<p>First post</p>]]></content:encoded>
+<dc:creator>Jane</dc:creator><dc:date>2006-01-02T15:04:05Z</dc:date>
+<guid>https://example.com/hello</guid><category>go</category><category>rss</category></item>
+</channel></rss>`,
+			expect: RSSItem{
+				Title:       "Hello",
+				Link:        "https://example.com/hello",
+				Description: "First post",
+				Content:     "<p>First post</p>",
+				PubDate:     "2006-01-02T15:04:05Z",
+				DCDate:      "2006-01-02T15:04:05Z",
+				Author:      "Jane",
+				Creator:     "Jane",
+				GUID:        RSSGUID{Value: "https://example.com/hello"},
+				Categories:  []string{"go", "rss"},
+			},
+		},
+		{
+			testName: "atom 1.0",
+			body: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<link href="https://example.com/"/>
+<entry><title type="html">Hello</title><id>tag:example.com,2006:1</id>
+<link rel="edit" href="https://example.com/edit/1"/>
+<link rel="alternate" type="text/html" href="https://example.com/hello"/>
+<updated>2006-01-03T15:04:05Z</updated><published>2006-01-02T15:04:05Z</published>
+<author><name>Jane</name></author><category term="go"/>
+<content type="html">First post</content></entry>
+</feed>`,
+			expect: RSSItem{
+				Title:       "Hello",
+				Link:        "https://example.com/hello",
+				Description: "First post",
+				Content:     "First post",
+				PubDate:     "2006-01-02T15:04:05Z",
+				Author:      "Jane",
+				GUID:        RSSGUID{Value: "tag:example.com,2006:1", IsPermaLink: "false"},
+				Categories:  []string{"go"},
+			},
+		},
+		{
+			testName: "rss 1.0",
+			body: `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/"
+ xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel rdf:about="https://example.com/"><title>Blog</title><link>https://example.com/</link>
+<items><rdf:Seq><rdf:li rdf:resource="https://example.com/hello"/></rdf:Seq></items></channel>
+<item rdf:about="https://example.com/hello"><title>Hello</title><link>https://example.com/hello</link>
+<description>First post</description><dc:date>2006-01-02T15:04:05Z</dc:date><dc:creator>Jane</dc:creator></item>
+</rdf:RDF>`,
+			expect: RSSItem{
+				Title:       "Hello",
+				Link:        "https://example.com/hello",
+				Description: "First post",
+				PubDate:     "2006-01-02T15:04:05Z",
+				Author:      "Jane",
+				GUID:        RSSGUID{Value: "https://example.com/hello", IsPermaLink: "true"},
+			},
+		},
+		{
+			testName:    "json feed 1.1",
+			contentType: "application/feed+json",
+			body: `{"version": "https://jsonfeed.org/version/1.1", "title": "Blog",
+"items": [{"id": "1", "url": "https://example.com/hello", "title": "Hello",
+"content_html": "<p>First post</p>", "date_published": "2006-01-02T15:04:05Z",
+"authors": [{"name": "Jane"}],
+"attachments": [{"url": "https://example.com/hello.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 1024}]}]}`,
+			expect: RSSItem{
+				Title:       "Hello",
+				Link:        "https://example.com/hello",
+				Description: "<p>First post</p>",
+				Content:     "<p>First post</p>",
+				PubDate:     "2006-01-02T15:04:05Z",
+				Author:      "Jane",
+				GUID:        RSSGUID{Value: "1", IsPermaLink: "false"},
+				Enclosures: []RSSEnclosure{
+					{URL: "https://example.com/hello.mp3", Type: "audio/mpeg", Length: "1024"},
+				},
+			},
+		},
+		{
+			testName: "json feed 1.0 without a content type",
+			body: `  {"version": "https://jsonfeed.org/version/1", "title": "Blog",
+"items": [{"id": "1", "url": "https://example.com/hello", "title": "Hello",
+"content_text": "First post", "date_published": "2006-01-02T15:04:05Z", "author": {"name": "Jane"}}]}`,
+			expect: RSSItem{
+				Title:       "Hello",
+				Link:        "https://example.com/hello",
+				Description: "First post",
+				Content:     "First post",
+				PubDate:     "2006-01-02T15:04:05Z",
+				Author:      "Jane",
+				GUID:        RSSGUID{Value: "1", IsPermaLink: "false"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseFeed([]byte(test.body), test.contentType)
+		if err != nil {
+			t.Errorf("Error testing %v: %v", test.testName, err)
+			continue
+		}
+		if len(got.Channel.Item) != 1 {
+			t.Errorf("Error testing %v: expected 1 item but got %v", test.testName, len(got.Channel.Item))
+			continue
+		}
+		if !reflect.DeepEqual(got.Channel.Item[0], test.expect) {
+			t.Errorf("Error testing %v: expected %v but got %v", test.testName, test.expect, got.Channel.Item[0])
+		}
+	}
+}
+
+// TestParseFeedUnknownFormat checks that documents we can't read are reported rather than returning no items
+func TestParseFeedUnknownFormat(t *testing.T) {
+	_, err := parseFeed([]byte(`<html><body>not a feed</body></html>`), "text/html")
+	if err == nil {
+		t.Errorf("Error testing unknown format: expected an error but got nil")
+	}
+}
+
+// TestParseFeedEncodings checks that feeds in other encodings are converted to UTF-8, whether the
+// encoding comes from the XML declaration, the Content-Type header or a byte order mark
+func TestParseFeedEncodings(t *testing.T) {
+	tests := []testParseFeedStruct{
+		{
+			testName: "iso-8859-1 declaration",
+			body:     "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><item><title>Caf\xe9</title></item></channel></rss>",
+			expect:   RSSItem{Title: "Café"},
+		},
+		{
+			testName:    "windows-1252 content type",
+			contentType: "application/rss+xml; charset=windows-1252",
+			body:        "<?xml version=\"1.0\"?><rss><channel><item><title>\x93Caf\xe9\x94</title></item></channel></rss>",
+			expect:      RSSItem{Title: "“Café”"},
+		},
+		{
+			testName:    "koi8-r content type overrides the declaration",
+			contentType: "text/xml; charset=koi8-r",
+			body:        "<?xml version=\"1.0\" encoding=\"utf-8\"?><rss><channel><item><title>\xf0\xd2\xc9\xd7\xc5\xd4</title></item></channel></rss>",
+			expect:      RSSItem{Title: "Привет"},
+		},
+		{
+			testName: "shift_jis declaration",
+			body:     "<?xml version=\"1.0\" encoding=\"Shift_JIS\"?><rss><channel><item><title>\x93\xfa\x96\x7b</title></item></channel></rss>",
+			expect:   RSSItem{Title: "日本"},
+		},
+		{
+			testName: "utf-8 byte order mark",
+			body:     "\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"utf-8\"?><rss><channel><item><title>Café</title></item></channel></rss>",
+			expect:   RSSItem{Title: "Café"},
+		},
+		{
+			testName: "utf-16 byte order mark",
+			body:     utf16LE("<?xml version=\"1.0\" encoding=\"UTF-16\"?><rss><channel><item><title>Café</title></item></channel></rss>"),
+			expect:   RSSItem{Title: "Café"},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseFeed([]byte(test.body), test.contentType)
+		if err != nil {
+			t.Errorf("Error testing %v: %v", test.testName, err)
+			continue
+		}
+		if len(got.Channel.Item) != 1 || got.Channel.Item[0].Title != test.expect.Title {
+			t.Errorf("Error testing %v: expected %v but got %v", test.testName, test.expect.Title, got.Channel.Item)
+		}
+	}
+}
+
+// encodes a string as UTF-16 little endian with a byte order mark
+func utf16LE(value string) string {
+	encoded := []byte{0xFF, 0xFE}
+	for _, r := range utf16.Encode([]rune(value)) {
+		encoded = append(encoded, byte(r), byte(r>>8))
+	}
+	return string(encoded)
+}
+
+// TestParseFeedMalformed checks that broken feeds are salvaged with a warning instead of failing
+func TestParseFeedMalformed(t *testing.T) {
+	tests := []struct {
+		testName string
+		body     string
+		expect   []string
+	}{
+		{
+			testName: "unescaped ampersand",
+			body:     `<rss><channel><item><title>Fish & Chips</title></item></channel></rss>`,
+			expect:   []string{"Fish & Chips"},
+		},
+		{
+			testName: "html entity",
+			body:     `<rss><channel><item><title>Fish&nbsp;&amp;&nbsp;Chips</title></item></channel></rss>`,
+			expect:   []string{"Fish\u00a0&\u00a0Chips"},
+		},
+		{
+			testName: "control character",
+			body:     "<rss><channel><item><title>Fish\x0b Chips</title></item></channel></rss>",
+			expect:   []string{"Fish Chips"},
+		},
+		{
+			testName: "ampersand in cdata",
+			body:     "<rss><channel><item><title><![CDATA[Fish &amp; Chips]]></title><description>\x01</description></item></channel></rss>",
+			expect:   []string{"Fish &amp; Chips"},
+		},
+		{
+			testName: "truncated",
+			body:     `<rss><channel><item><title>One</title></item><item><title>Two</title></item><item><title>Thr`,
+			expect:   []string{"One", "Two"},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseFeed([]byte(test.body), "")
+		if err != nil {
+			t.Errorf("Error testing %v: %v", test.testName, err)
+			continue
+		}
+		if len(got.Warnings) == 0 {
+			t.Errorf("Error testing %v: expected a warning but got none", test.testName)
+		}
+		var titles []string
+		for _, item := range got.Channel.Item {
+			titles = append(titles, item.Title)
+		}
+		if !reflect.DeepEqual(titles, test.expect) {
+			t.Errorf("Error testing %v: expected %v but got %v", test.testName, test.expect, titles)
+		}
+	}
+}
+
+// TestItemCategories checks that an item without categories is sent to the database as an empty array
+// rather than NULL, which the categories column doesn't allow
+func TestItemCategories(t *testing.T) {
+	cases := []struct {
+		testName string
+		item     RSSItem
+		expect   any
+	}{
+		{testName: "no categories", item: RSSItem{}, expect: "{}"},
+		{testName: "categories", item: RSSItem{Categories: []string{"go", "rss"}}, expect: `{"go","rss"}`},
+	}
+	for _, c := range cases {
+		actual, err := pq.Array(c.item.categoryList()).Value()
+		if err != nil || actual != c.expect {
+			t.Errorf("Error testing %v: expected %v but got %v (%v)", c.testName, c.expect, actual, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+)
+
+// the number of recent posts used to work out how often a feed publishes
+const postFrequencySample = 10
+
+// the length of each sy:updatePeriod, which defaults to daily
+var updatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// hints about when a feed is next worth fetching, from the feed itself and the server it came from
+type refreshHints struct {
+	// the least time the publisher wants left between fetches, from <ttl> or sy:updatePeriod
+	ttl        time.Duration
+	skipHours  map[int]bool
+	skipDays   map[time.Weekday]bool
+	freshUntil time.Time
+	// new posts are pushed to us by a WebSub hub, so polling is only a fallback
+	pushed bool
+}
+
+// collects the refresh hints from a feed and the cache details of the response it came in. The feed is
+// nil when it hasn't changed, in which case only the response's hints are available
+func feedRefreshHints(feed *RSSFeed, cache feedCache) refreshHints {
+	hints := refreshHints{freshUntil: cache.FreshUntil}
+	if feed == nil {
+		return hints
+	}
+	minutes, err := strconv.Atoi(strings.TrimSpace(feed.Channel.TTL))
+	if err == nil && minutes > 0 {
+		hints.ttl = time.Duration(minutes) * time.Minute
+	}
+	if feed.Channel.UpdatePeriod != "" || feed.Channel.UpdateFrequency != "" {
+		period, ok := updatePeriods[strings.ToLower(strings.TrimSpace(feed.Channel.UpdatePeriod))]
+		if !ok {
+			period = updatePeriods["daily"]
+		}
+		frequency, err := strconv.Atoi(strings.TrimSpace(feed.Channel.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		hints.ttl = max(hints.ttl, period/time.Duration(frequency))
+	}
+	for _, hour := range feed.Channel.SkipHours {
+		h, err := strconv.Atoi(strings.TrimSpace(hour))
+		if err == nil && h >= 0 && h < 24 {
+			if hints.skipHours == nil {
+				hints.skipHours = make(map[int]bool)
+			}
+			hints.skipHours[h] = true
+		}
+	}
+	for _, day := range feed.Channel.SkipDays {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(strings.TrimSpace(day), d.String()) {
+				if hints.skipDays == nil {
+					hints.skipDays = make(map[time.Weekday]bool)
+				}
+				hints.skipDays[d] = true
+			}
+		}
+	}
+	return hints
+}
+
+// works out when a feed should next be fetched. A feed is fetched twice as often as it has published
+// over its recent posts, but no sooner than the publisher or server asks, and never sooner than minGap
+// or later than maxGap. A feed that hasn't changed is left at least as long as last time, and a feed
+// that is pushed to us is only polled every maxGap. If the time lands in an hour or day the feed says to
+// skip, it is moved to the next hour that isn't skipped
+func nextFetchTime(now time.Time, hints refreshHints, postDates []time.Time, previousGap, minGap, maxGap time.Duration) time.Time {
+	gap := minGap
+	if interval := postingInterval(now, postDates); interval > 0 {
+		gap = interval / 2
+	}
+	gap = max(gap, hints.ttl, previousGap, hints.freshUntil.Sub(now))
+	if hints.pushed {
+		gap = max(gap, maxGap)
+	}
+	gap = min(max(gap, minGap), max(maxGap, minGap))
+	// skipHours and skipDays are in UTC, but the result is returned in the same time zone as now so it is
+	// saved the same way as the NOW() it is compared with
+	next := now.Add(gap).UTC()
+	for i := 0; i < 7*24 && (hints.skipHours[next.Hour()] || hints.skipDays[next.Weekday()]); i++ {
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next.In(now.Location())
+}
+
+// returns how often a feed has published on average, from the dates of its recent posts newest first.
+// Returns 0 when there aren't enough posts to tell
+func postingInterval(now time.Time, postDates []time.Time) time.Duration {
+	if len(postDates) < 2 {
+		return 0
+	}
+	oldest := postDates[len(postDates)-1]
+	return now.Sub(oldest) / time.Duration(len(postDates))
+}
+
+// schedules the next fetch of a feed that was just fetched successfully, using the dates of its recent
+// posts, the hints from the fetch and whether it has a live WebSub subscription. The gap is kept between
+// minGap and maxGap
+func scheduleNextFetch(ctx context.Context, s *state, feed database.Feed, result scrapeResult, minGap, maxGap time.Duration) (time.Time, error) {
+	postDates, err := s.db.GetRecentPostDates(ctx, database.GetRecentPostDatesParams{
+		FeedID: feed.ID,
+		Limit:  postFrequencySample,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if s.cfg.WebSubCallback != "" {
+		sub, err := s.db.GetWebSubSubscriptionForFeed(ctx, feed.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, err
+		}
+		result.hints.pushed = err == nil && sub.LeaseExpiresAt.Valid && sub.LeaseExpiresAt.Time.After(time.Now())
+	}
+	var previousGap time.Duration
+	if result.unchanged && feed.NextFetchAt.Valid && feed.LastFetchedAt.Valid {
+		previousGap = feed.NextFetchAt.Time.Sub(feed.LastFetchedAt.Time)
+	}
+	return nextFetchTime(time.Now(), result.hints, postDates, previousGap, minGap, maxGap), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestNextFetchTime checks that feeds are scheduled from how often they post and the hints they give
+func TestNextFetchTime(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	daily := []time.Time{now.Add(-24 * time.Hour), now.Add(-48 * time.Hour), now.Add(-72 * time.Hour)}
+	cases := []struct {
+		testName    string
+		hints       refreshHints
+		postDates   []time.Time
+		previousGap time.Duration
+		expect      time.Time
+	}{
+		{testName: "no posts", expect: now.Add(time.Minute)},
+		{testName: "daily posts", postDates: daily, expect: now.Add(12 * time.Hour)},
+		{testName: "ttl", hints: refreshHints{ttl: 2 * time.Hour}, expect: now.Add(2 * time.Hour)},
+		{testName: "fresh until", hints: refreshHints{freshUntil: now.Add(30 * time.Minute)}, expect: now.Add(30 * time.Minute)},
+		{testName: "unchanged", previousGap: 3 * time.Hour, expect: now.Add(3 * time.Hour)},
+		{testName: "max", postDates: []time.Time{now.AddDate(-1, 0, 0), now.AddDate(-2, 0, 0)}, expect: now.Add(24 * time.Hour)},
+		{testName: "skip hours", hints: refreshHints{skipHours: map[int]bool{12: true, 13: true}}, expect: now.Add(2 * time.Hour)},
+		{testName: "pushed", hints: refreshHints{pushed: true}, postDates: daily, expect: now.Add(24 * time.Hour)},
+		{testName: "skip days", hints: refreshHints{skipDays: map[time.Weekday]bool{time.Friday: true}}, expect: now.Add(12 * time.Hour)},
+	}
+	for _, c := range cases {
+		got := nextFetchTime(now, c.hints, c.postDates, c.previousGap, time.Minute, 24*time.Hour)
+		if !got.Equal(c.expect) {
+			t.Errorf("Error testing %v: expected %v but got %v", c.testName, c.expect, got)
+		}
+	}
+}
+
+// TestNextFetchTimeZone checks that the next fetch is in the same time zone as now, since the column it is
+// saved in has no time zone and is compared with NOW()
+func TestNextFetchTimeZone(t *testing.T) {
+	zone := time.FixedZone("UTC+10", 10*60*60)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, zone)
+	hints := refreshHints{skipHours: map[int]bool{2: true}}
+	got := nextFetchTime(now, hints, nil, 0, time.Minute, 24*time.Hour)
+	expect := time.Date(2024, time.March, 1, 13, 0, 0, 0, zone)
+	if got.Location() != zone || !got.Equal(expect) {
+		t.Errorf("Error testing time zone: expected %v but got %v", expect, got)
+	}
+}
+
+// TestFeedRefreshHints checks that the scheduling hints are read from the channel
+func TestFeedRefreshHints(t *testing.T) {
+	body := `<rss xmlns:sy="http://purl.org/rss/1.0/modules/syndication/"><channel>
+		<ttl>60</ttl>
+		<sy:updatePeriod>daily</sy:updatePeriod>
+		<sy:updateFrequency>4</sy:updateFrequency>
+		<skipHours><hour>0</hour><hour>1</hour><hour>25</hour></skipHours>
+		<skipDays><day>Sunday</day></skipDays>
+	</channel></rss>`
+	feed, err := parseFeed([]byte(body), "application/rss+xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints := feedRefreshHints(feed, feedCache{})
+	if hints.ttl != 6*time.Hour {
+		t.Errorf("Error testing ttl: expected %v but got %v", 6*time.Hour, hints.ttl)
+	}
+	if len(hints.skipHours) != 2 || !hints.skipHours[0] || !hints.skipHours[1] {
+		t.Errorf("Error testing skipHours: expected 0 and 1 but got %v", hints.skipHours)
+	}
+	if len(hints.skipDays) != 1 || !hints.skipDays[time.Sunday] {
+		t.Errorf("Error testing skipDays: expected Sunday but got %v", hints.skipDays)
+	}
+}
+
+// TestParseFreshness checks that Cache-Control and Expires are turned into the time a response goes stale
+func TestParseFreshness(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		testName string
+		header   http.Header
+		expect   time.Time
+	}{
+		{testName: "max-age", header: http.Header{"Cache-Control": {"public, max-age=600"}}, expect: now.Add(10 * time.Minute)},
+		{testName: "age", header: http.Header{"Cache-Control": {"max-age=600"}, "Age": {"120"}}, expect: now.Add(8 * time.Minute)},
+		{testName: "no-cache", header: http.Header{"Cache-Control": {"max-age=600, no-cache"}}},
+		{testName: "expires", header: http.Header{"Expires": {"Fri, 01 Mar 2024 13:00:00 GMT"}}, expect: now.Add(time.Hour)},
+		{testName: "none", header: http.Header{}},
+	}
+	for _, c := range cases {
+		got := parseFreshness(c.header, now)
+		if !got.Equal(c.expect) {
+			t.Errorf("Error testing %v: expected %v but got %v", c.testName, c.expect, got)
+		}
+	}
+}
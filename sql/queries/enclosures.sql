@@ -0,0 +1,30 @@
+-- name: CreateEnclosure :exec
+INSERT INTO enclosures (id, created_at, updated_at, post_id, url, mime_type, length, duration_seconds, image_url)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+)
+ON CONFLICT (post_id, url) DO NOTHING;
+
+-- name: GetEnclosuresForPost :many
+SELECT * FROM enclosures
+WHERE post_id = $1
+ORDER BY url;
+
+-- name: GetFollowedPodcastEnclosures :many
+SELECT e.*, p.title AS post_title, p.published_at, f.name AS feed_name,
+    DENSE_RANK() OVER (PARTITION BY p.feed_id ORDER BY p.published_at DESC, p.id) AS feed_rank
+FROM enclosures e
+INNER JOIN posts p ON e.post_id = p.id
+INNER JOIN feeds f ON p.feed_id = f.id
+INNER JOIN feed_follows ff ON f.id = ff.feed_id
+WHERE ff.user_id = $1
+AND (e.mime_type LIKE 'audio/%' OR e.mime_type LIKE 'video/%')
+ORDER BY f.name, feed_rank;
\ No newline at end of file
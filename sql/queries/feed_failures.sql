@@ -0,0 +1,16 @@
+-- name: CreateFeedFailure :exec
+INSERT INTO feed_failures (id, created_at, feed_id, status_code, error_class, message)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
+
+-- name: GetLatestFeedFailure :one
+SELECT * FROM feed_failures
+WHERE feed_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
\ No newline at end of file
@@ -0,0 +1,32 @@
+-- name: CreateFeedFetch :exec
+INSERT INTO feed_fetches (id, feed_id, started_at, duration_ms, status_code, bytes, items_seen, new_items, error)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+);
+
+-- name: DeleteFeedFetchesBefore :exec
+DELETE FROM feed_fetches
+WHERE started_at < $1;
+
+-- name: GetFeedFetches :many
+SELECT * FROM feed_fetches
+WHERE feed_id = $1
+ORDER BY started_at DESC;
+
+-- name: GetFeedStatuses :many
+SELECT f.name, f.url, f.consecutive_failures, f.disabled_at, f.next_fetch_at, f.next_retry_at,
+    COUNT(ff.id) AS fetches,
+    COUNT(ff.id) FILTER (WHERE ff.error IS NULL) AS successes,
+    MAX(ff.started_at) FILTER (WHERE ff.error IS NULL) AS last_success
+FROM feeds f
+LEFT JOIN feed_fetches ff ON ff.feed_id = f.id
+GROUP BY f.id
+ORDER BY f.name;
\ No newline at end of file
@@ -25,4 +25,18 @@ WHERE ff.user_id = $1;
 -- name: DeleteFollowedFeed :exec
 DELETE FROM feed_follows 
 WHERE user_id = $1
-AND feed_id = $2;
\ No newline at end of file
+AND feed_id = $2;
+
+-- name: GetDisabledFeedsUserFollows :many
+SELECT f.name, f.url, f.disabled_at
+FROM feeds f
+INNER JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+AND f.disabled_at IS NOT NULL
+ORDER BY f.name;
+
+-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = sqlc.arg(to_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(from_feed_id)
+AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = sqlc.arg(to_feed_id));
\ No newline at end of file
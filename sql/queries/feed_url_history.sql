@@ -0,0 +1,15 @@
+-- name: AddFeedURLHistory :exec
+INSERT INTO feed_url_history (id, created_at, feed_id, url)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (url) DO UPDATE
+SET feed_id = EXCLUDED.feed_id, created_at = EXCLUDED.created_at;
+
+-- name: MoveFeedURLHistory :exec
+UPDATE feed_url_history
+SET feed_id = sqlc.arg(to_feed_id)
+WHERE feed_id = sqlc.arg(from_feed_id);
\ No newline at end of file
@@ -15,16 +15,93 @@ SELECT f.*, u.name as user_name FROM feeds f
 INNER JOIN users u ON f.user_id = u.id;
 
 -- name: GetFeedsByURL :one
-SELECT * FROM feeds
-WHERE url = $1;
+SELECT f.* FROM feeds f
+WHERE f.url = $1
+OR f.id = (SELECT feed_id FROM feed_url_history WHERE feed_url_history.url = $1)
+ORDER BY f.url = $1 DESC
+LIMIT 1;
 
 -- name: MarkFeedFetched :exec
 UPDATE feeds
-SET updated_at = NOW(), last_fetched_at = NOW()
+SET updated_at = NOW(), last_fetched_at = NOW(), claimed_until = NULL, consecutive_failures = 0, next_retry_at = NULL, next_fetch_at = $2
+WHERE id = $1;
+
+-- name: SetFeedNextFetch :exec
+UPDATE feeds
+SET updated_at = NOW(), last_fetched_at = NOW(), next_fetch_at = $2
+WHERE id = $1;
+
+-- name: MarkFeedFailed :one
+UPDATE feeds
+SET updated_at = NOW(), last_fetched_at = NOW(), claimed_until = NULL,
+    consecutive_failures = consecutive_failures + 1,
+    next_retry_at = sqlc.arg(retry_at)::timestamp,
+    disabled_at = CASE WHEN consecutive_failures + 1 >= sqlc.arg(disable_after)::integer THEN NOW() ELSE disabled_at END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: DeferFeed :exec
+UPDATE feeds
+SET updated_at = NOW(), claimed_until = NULL, next_retry_at = $2
+WHERE id = $1;
+
+-- name: SetFeedWarning :exec
+UPDATE feeds
+SET last_warning = $2
+WHERE id = $1;
+
+-- name: SetFeedCache :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, content_hash = $4
+WHERE id = $1;
+
+-- name: ClaimFeed :one
+UPDATE feeds
+SET claimed_until = NOW() + sqlc.arg(lease_seconds)::integer * INTERVAL '1 second'
+WHERE id = sqlc.arg(id)
+AND (claimed_until IS NULL OR claimed_until < NOW())
+RETURNING *;
+
+-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET claimed_until = NOW() + sqlc.arg(lease_seconds)::integer * INTERVAL '1 second'
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+    AND (COALESCE(next_retry_at, next_fetch_at) IS NULL OR COALESCE(next_retry_at, next_fetch_at) <= sqlc.arg(due_before)::timestamp)
+    AND (claimed_until IS NULL OR claimed_until < NOW())
+    ORDER BY COALESCE(next_retry_at, next_fetch_at)
+    NULLS FIRST
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: GetBrokenFeeds :many
+SELECT f.*, u.name as user_name FROM feeds f
+INNER JOIN users u ON f.user_id = u.id
+WHERE f.consecutive_failures > 0
+ORDER BY f.disabled_at NULLS LAST, f.consecutive_failures DESC;
+
+-- name: ReenableFeed :one
+UPDATE feeds
+SET updated_at = NOW(), consecutive_failures = 0, next_retry_at = NULL, disabled_at = NULL
+WHERE url = $1
+RETURNING *;
+
+-- name: SetFeedURL :exec
+UPDATE feeds
+SET url = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteFeed :exec
+DELETE FROM feeds
 WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
-SELECT * FROM feeds 
-ORDER BY last_fetched_at 
-NULLS FIRST 
-LIMIT 1;
\ No newline at end of file
+-- name: GetFeedByID :one
+SELECT * FROM feeds
+WHERE id = $1;
+
+-- name: GetFeedByName :one
+SELECT * FROM feeds
+WHERE name = $1;
\ No newline at end of file
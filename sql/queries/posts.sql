@@ -1,5 +1,5 @@
--- name: CreatePost :exec
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+-- name: CreatePost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, author, guid, guid_is_permalink, categories)
 VALUES (
     $1,
     $2,
@@ -8,8 +8,14 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
-);
+    $8,
+    $9,
+    $10,
+    $11,
+    $12,
+    $13
+)
+RETURNING id;
 
 -- name: GetPostsForUser :many
 SELECT p.*
@@ -17,4 +23,22 @@ FROM posts p
 INNER JOIN feed_follows ff ON p.feed_id = ff.feed_id
 WHERE ff.user_id = $1
 ORDER BY p.published_at DESC
-LIMIT $2;
\ No newline at end of file
+LIMIT $2;
+
+-- name: GetRecentPostDates :many
+SELECT published_at FROM posts
+WHERE feed_id = $1
+ORDER BY published_at DESC
+LIMIT $2;
+
+-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = sqlc.arg(to_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(from_feed_id);
+
+-- name: UpdatePost :execrows
+UPDATE posts
+SET title = $3, description = $4, content = $5, author = $6, categories = $7, updated_at = NOW()
+WHERE url = $1
+AND feed_id = $2
+AND (title <> $3 OR description <> $4 OR content <> $5 OR author <> $6 OR categories <> $7);
\ No newline at end of file
@@ -0,0 +1,36 @@
+-- name: UpsertWebSubSubscription :one
+INSERT INTO websub_subscriptions (id, created_at, updated_at, feed_id, hub_url, topic_url, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (feed_id) DO UPDATE
+SET updated_at = EXCLUDED.updated_at, hub_url = EXCLUDED.hub_url, topic_url = EXCLUDED.topic_url
+RETURNING *;
+
+-- name: GetWebSubSubscription :one
+SELECT * FROM websub_subscriptions
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionForFeed :one
+SELECT * FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: VerifyWebSubSubscription :exec
+UPDATE websub_subscriptions
+SET verified_at = NOW(), updated_at = NOW(), lease_expires_at = NOW() + sqlc.arg(lease_seconds)::integer * INTERVAL '1 second'
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteWebSubSubscription :exec
+DELETE FROM websub_subscriptions
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+SELECT * FROM websub_subscriptions
+WHERE (lease_expires_at IS NOT NULL AND lease_expires_at < NOW() + sqlc.arg(renew_seconds)::integer * INTERVAL '1 second')
+OR (lease_expires_at IS NULL AND updated_at < NOW() - sqlc.arg(renew_seconds)::integer * INTERVAL '1 second');
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE posts
+    ALTER COLUMN title TYPE TEXT,
+    ALTER COLUMN url TYPE TEXT,
+    ALTER COLUMN description TYPE TEXT,
+    ADD COLUMN content TEXT NOT NULL DEFAULT '',
+    ADD COLUMN author TEXT NOT NULL DEFAULT '',
+    ADD COLUMN guid TEXT NOT NULL DEFAULT '',
+    ADD COLUMN guid_is_permalink BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE posts
+    DROP COLUMN categories,
+    DROP COLUMN guid_is_permalink,
+    DROP COLUMN guid,
+    DROP COLUMN author,
+    DROP COLUMN content,
+    ALTER COLUMN description TYPE VARCHAR(255),
+    ALTER COLUMN url TYPE VARCHAR(255),
+    ALTER COLUMN title TYPE VARCHAR(255);
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN last_warning TEXT;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN last_warning;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE enclosures(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    post_id UUID NOT NULL REFERENCES posts(id)
+        ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    length BIGINT,
+    duration_seconds INTEGER,
+    image_url TEXT,
+    CONSTRAINT uq_post_id_url UNIQUE (post_id, url)
+);
+
+-- +goose Down
+DROP TABLE enclosures;
\ No newline at end of file
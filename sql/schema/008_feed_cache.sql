@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD COLUMN etag TEXT,
+    ADD COLUMN last_modified TEXT,
+    ADD COLUMN content_hash TEXT;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN content_hash,
+    DROP COLUMN last_modified,
+    DROP COLUMN etag;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE feed_failures(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL REFERENCES feeds(id)
+        ON DELETE CASCADE,
+    status_code INTEGER,
+    error_class TEXT NOT NULL,
+    message TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE feed_failures;
\ No newline at end of file
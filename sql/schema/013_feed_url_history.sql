@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE feed_url_history(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL REFERENCES feeds(id)
+        ON DELETE CASCADE,
+    url TEXT UNIQUE NOT NULL
+);
+
+-- +goose Down
+DROP TABLE feed_url_history;
\ No newline at end of file
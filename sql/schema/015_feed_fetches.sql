@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE feed_fetches(
+    id UUID PRIMARY KEY,
+    feed_id UUID NOT NULL REFERENCES feeds(id)
+        ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    status_code INTEGER,
+    bytes BIGINT NOT NULL,
+    items_seen INTEGER NOT NULL,
+    new_items INTEGER NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX idx_feed_fetches_feed_id_started_at ON feed_fetches(feed_id, started_at);
+
+CREATE INDEX idx_feed_fetches_started_at ON feed_fetches(started_at);
+
+-- +goose Down
+DROP TABLE feed_fetches;
\ No newline at end of file
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// ranges that aren't covered by the netip helpers but still shouldn't be reachable from a feed URL
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// decides which URLs gator is allowed to fetch. Only http and https URLs are fetched, and loopback,
+// link-local, private and other internal addresses are refused unless their host or range is in the
+// allowed_hosts setting. Addresses are checked when a connection is made, after DNS has been resolved,
+// so a hostname that resolves to an internal address is caught and so is every redirect. Requests that
+// go through a proxy only connect to the proxy, so their hostnames are resolved and checked beforehand
+type urlPolicy struct {
+	hosts    map[string]bool
+	prefixes []netip.Prefix
+	// connections to the proxy are always allowed, the proxy does its own resolving
+	proxies map[string]bool
+	// returns the proxy a request goes through, if any, the same way the transport picks it
+	proxy func(*http.Request) (*url.URL, error)
+	// resolves a hostname, so the addresses behind a proxied URL can be checked
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// creates a policy from the allowed_hosts setting. Each entry is a hostname, an IP address or a CIDR
+// range like 10.1.0.0/16. The proxy URL, if there is one, is allowed too
+func newURLPolicy(allowed []string, proxyURL string) *urlPolicy {
+	policy := &urlPolicy{
+		hosts:   make(map[string]bool),
+		proxies: make(map[string]bool),
+		proxy:   http.ProxyFromEnvironment,
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			policy.prefixes = append(policy.prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			policy.prefixes = append(policy.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else if entry != "" {
+			policy.hosts[entry] = true
+		}
+	}
+	if parsed, err := url.Parse(proxyURL); err == nil && proxyURL != "" {
+		policy.proxy = http.ProxyURL(parsed)
+	}
+	proxies := []string{proxyURL}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		proxies = append(proxies, os.Getenv(name))
+	}
+	for _, proxy := range proxies {
+		if proxy == "" {
+			continue
+		}
+		parsed, err := url.Parse(proxy)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+		port := parsed.Port()
+		if port == "" {
+			port = "80"
+			if parsed.Scheme == "https" {
+				port = "443"
+			}
+		}
+		policy.proxies[net.JoinHostPort(parsed.Hostname(), port)] = true
+	}
+	return policy
+}
+
+// checks a URL before it is requested. The scheme has to be http or https, and a host that is an IP
+// address or a localhost name is checked straight away rather than waiting for the connection. If the
+// request will go through a proxy the connection is only made to the proxy, so the host is resolved here
+// and every address it resolves to has to be allowed
+func (p *urlPolicy) checkURL(ctx context.Context, target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https URLs can be fetched, not %v", errBlockedURL, target.Scheme)
+	}
+	host := strings.ToLower(target.Hostname())
+	if p.hosts[host] {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %v is a loopback address", errBlockedURL, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !p.allowedAddr(addr) {
+			return fmt.Errorf("%w: %v is an internal address", errBlockedURL, host)
+		}
+		return nil
+	}
+	proxy, err := p.proxy(&http.Request{URL: target})
+	if err != nil || proxy == nil {
+		return err
+	}
+	addrs, err := p.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: could not resolve %v to check it: %v", errBlockedURL, host, err)
+	}
+	for _, addr := range addrs {
+		if !p.allowedAddr(addr) {
+			return fmt.Errorf("%w: %v resolves to an internal address, %v", errBlockedURL, host, addr)
+		}
+	}
+	return nil
+}
+
+// reports whether an address can be connected to, either because it is public or because it is in an
+// allowed range
+func (p *urlPolicy) allowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return !blockedAddr(addr)
+}
+
+// reports whether an address is loopback, link-local, private or otherwise not on the public internet
+func blockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// wraps a dialer so that every connection is checked against the policy once its address has been
+// resolved. Hosts in allowed_hosts and the proxy are dialled without the check
+func (p *urlPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.Control = func(network, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: could not check address %v: %v", errBlockedURL, address, err)
+		}
+		if !p.allowedAddr(addrPort.Addr()) {
+			return fmt.Errorf("%w: %v is an internal address", errBlockedURL, addrPort.Addr())
+		}
+		return nil
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && (p.hosts[strings.ToLower(host)] || p.proxies[address]) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
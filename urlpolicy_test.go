@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/config"
+)
+
+// TestURLPolicy checks which URLs are refused before a request is made
+func TestURLPolicy(t *testing.T) {
+	policy := newURLPolicy([]string{"intranet.example.com", "10.1.0.0/16", "192.168.1.5"}, "")
+	cases := []struct {
+		testName string
+		url      string
+		allowed  bool
+	}{
+		{testName: "public", url: "https://example.com/feed", allowed: true},
+		{testName: "file scheme", url: "file:///etc/passwd"},
+		{testName: "ftp scheme", url: "ftp://example.com/feed"},
+		{testName: "metadata service", url: "http://169.254.169.254/latest/meta-data/"},
+		{testName: "loopback", url: "http://127.0.0.1:5432/"},
+		{testName: "localhost", url: "http://localhost:5432/"},
+		{testName: "ipv6 loopback", url: "http://[::1]/"},
+		{testName: "mapped loopback", url: "http://[::ffff:127.0.0.1]/"},
+		{testName: "private", url: "http://10.0.0.1/"},
+		{testName: "allowed range", url: "http://10.1.2.3/feed", allowed: true},
+		{testName: "allowed address", url: "http://192.168.1.5/feed", allowed: true},
+		{testName: "allowed host", url: "http://intranet.example.com/feed", allowed: true},
+	}
+	for _, c := range cases {
+		target, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = policy.checkURL(context.Background(), target)
+		if (err == nil) != c.allowed {
+			t.Errorf("Error testing %v: expected allowed to be %v but got %v", c.testName, c.allowed, err)
+		}
+	}
+}
+
+// TestURLPolicyProxied checks that when requests go through a proxy, hostnames are resolved and refused
+// if they lead to an internal address, since the connection itself is only made to the proxy
+func TestURLPolicyProxied(t *testing.T) {
+	policy := newURLPolicy([]string{"intranet.example.com"}, "http://proxy.example.com:3128")
+	policy.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		addrs := map[string][]string{
+			"public.example.com":   {"93.184.216.34"},
+			"metadata.example.com": {"169.254.169.254"},
+			"mixed.example.com":    {"93.184.216.34", "10.0.0.1"},
+		}[host]
+		if addrs == nil {
+			return nil, errors.New("no such host")
+		}
+		var parsed []netip.Addr
+		for _, addr := range addrs {
+			parsed = append(parsed, netip.MustParseAddr(addr))
+		}
+		return parsed, nil
+	}
+	cases := []struct {
+		testName string
+		url      string
+		allowed  bool
+	}{
+		{testName: "public", url: "https://public.example.com/feed", allowed: true},
+		{testName: "internal", url: "http://metadata.example.com/latest/meta-data/"},
+		{testName: "one internal address", url: "http://mixed.example.com/feed"},
+		{testName: "unresolvable", url: "http://missing.example.com/feed"},
+		{testName: "allowed host", url: "http://intranet.example.com/feed", allowed: true},
+	}
+	for _, c := range cases {
+		target, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = policy.checkURL(context.Background(), target)
+		if (err == nil) != c.allowed {
+			t.Errorf("Error testing %v: expected allowed to be %v but got %v", c.testName, c.allowed, err)
+		}
+	}
+}
+
+// TestBlockedAddr checks the address ranges that can't be connected to
+func TestBlockedAddr(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":         false,
+		"2606:4700::1111": false,
+		"127.0.0.1":       true,
+		"10.0.0.1":        true,
+		"172.16.0.1":      true,
+		"192.168.0.1":     true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+	}
+	for address, expect := range tests {
+		got := blockedAddr(netip.MustParseAddr(address))
+		if got != expect {
+			t.Errorf("Error testing %v: expected %v but got %v", address, expect, got)
+		}
+	}
+}
+
+// TestURLPolicyConnections checks that connections are refused once an address is resolved, and that
+// redirects to internal addresses aren't followed
+func TestURLPolicyConnections(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss><channel><title>Blog</title></channel></rss>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dial := newURLPolicy(nil, "").dialContext(&net.Dialer{})
+	_, err = dial(context.Background(), "tcp", serverURL.Host)
+	if !errors.Is(err, errBlockedURL) {
+		t.Errorf("Error testing dial: expected the loopback connection to be blocked but got %v", err)
+	}
+
+	f, err := newFetcher(config.Config{HostSpacing: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = f.fetchFeed(context.Background(), server.URL+"/feed", feedCache{})
+	class, _ := classifyError(err)
+	if class != "blocked" {
+		t.Errorf("Error testing default policy: expected blocked but got %v (%v)", class, err)
+	}
+	_, _, err = testFetcher(t).fetchFeed(context.Background(), server.URL+"/redirect", feedCache{})
+	class, _ = classifyError(err)
+	if class != "blocked" {
+		t.Errorf("Error testing redirect: expected blocked but got %v (%v)", class, err)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// how long we ask hubs to keep a subscription for, and how long before it runs out it is renewed
+const (
+	webSubLeaseSeconds = 10 * 24 * 60 * 60
+	webSubRenewBefore  = 24 * time.Hour
+)
+
+// the hash functions hubs can sign content with, keyed by the name used in X-Hub-Signature
+var webSubSignatures = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// returns the href of a feed's first link with the given rel, resolved against the feed's own URL.
+// Returns an empty string if there isn't one or it isn't an http or https URL
+func feedLink(feed *RSSFeed, rel string, base string) string {
+	for _, link := range feed.Channel.AtomLinks {
+		if link.Rel == rel {
+			return resolveLink(base, link.Href)
+		}
+	}
+	return ""
+}
+
+// resolves a possibly relative link against a base URL, only allowing http and https links
+func resolveLink(base string, href string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || href == "" {
+		return ""
+	}
+	resolved := baseURL.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	return resolved.String()
+}
+
+// the URL a hub sends a subscription's verification requests and content to
+func webSubCallbackURL(base string, id uuid.UUID) string {
+	return strings.TrimSuffix(base, "/") + "/" + id.String()
+}
+
+// reports whether a subscription should be renewed, because its lease is nearly up or because it was
+// never verified and the hub has had plenty of time
+func webSubNeedsRenewal(sub database.WebsubSubscription, now time.Time) bool {
+	if sub.LeaseExpiresAt.Valid {
+		return sub.LeaseExpiresAt.Time.Before(now.Add(webSubRenewBefore))
+	}
+	return sub.UpdatedAt.Before(now.Add(-webSubRenewBefore))
+}
+
+// subscribes to a feed's WebSub hub if it advertises one and we aren't already subscribed. The topic is
+// the feed's self link, or its URL if it doesn't have one. Push is only ever an addition to polling, so
+// problems are printed rather than failing the scrape
+func subscribeWebSub(ctx context.Context, s *state, feed database.Feed, rssFeed *RSSFeed) {
+	hub := feedLink(rssFeed, "hub", feed.Url)
+	if hub == "" {
+		return
+	}
+	topic := feedLink(rssFeed, "self", feed.Url)
+	if topic == "" {
+		topic = feed.Url
+	}
+	existing, err := s.db.GetWebSubSubscriptionForFeed(ctx, feed.ID)
+	if err == nil && existing.HubUrl == hub && existing.TopicUrl == topic && !webSubNeedsRenewal(existing, time.Now()) {
+		return
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Could not look up the WebSub subscription for %v: %v\n", feed.Name, err)
+		return
+	}
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	sub, err := s.db.UpsertWebSubSubscription(ctx, database.UpsertWebSubSubscriptionParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		FeedID:    feed.ID,
+		HubUrl:    hub,
+		TopicUrl:  topic,
+		Secret:    hex.EncodeToString(secret),
+	})
+	if err != nil {
+		fmt.Printf("Could not save the WebSub subscription for %v: %v\n", feed.Name, err)
+		return
+	}
+	err = s.fetcher.subscribeToHub(ctx, sub, webSubCallbackURL(s.cfg.WebSubCallback, sub.ID))
+	if err != nil {
+		fmt.Printf("Could not subscribe to %v at %v: %v\n", feed.Name, hub, err)
+		return
+	}
+	fmt.Printf("Subscribed to %v at %v, waiting for the hub to verify\n", feed.Name, hub)
+}
+
+// renews the subscriptions whose leases are nearly up, and retries the ones the hub never verified
+func renewWebSubSubscriptions(ctx context.Context, s *state) {
+	subs, err := s.db.GetWebSubSubscriptionsToRenew(ctx, int32(webSubRenewBefore.Seconds()))
+	if err != nil {
+		fmt.Printf("Could not find WebSub subscriptions to renew: %v\n", err)
+		return
+	}
+	for _, sub := range subs {
+		sub, err = s.db.UpsertWebSubSubscription(ctx, database.UpsertWebSubSubscriptionParams{
+			ID:        sub.ID,
+			CreatedAt: sub.CreatedAt,
+			UpdatedAt: time.Now(),
+			FeedID:    sub.FeedID,
+			HubUrl:    sub.HubUrl,
+			TopicUrl:  sub.TopicUrl,
+			Secret:    sub.Secret,
+		})
+		if err == nil {
+			err = s.fetcher.subscribeToHub(ctx, sub, webSubCallbackURL(s.cfg.WebSubCallback, sub.ID))
+		}
+		if err != nil {
+			fmt.Printf("Could not renew the WebSub subscription to %v: %v\n", sub.TopicUrl, err)
+		}
+	}
+}
+
+// sends a subscription request to a hub. The hub answers straight away, then confirms the subscription
+// later by calling the callback with a challenge
+func (f *fetcher) subscribeToHub(ctx context.Context, sub database.WebsubSubscription, callback string) error {
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.TopicUrl},
+		"hub.callback":      {callback},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(webSubLeaseSeconds)},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.HubUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	err = f.policy.checkURL(request.Context(), request.URL)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("User-Agent", f.userAgent)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	release, err := f.hosts.acquire(ctx, request.URL.Host)
+	if err != nil {
+		return err
+	}
+	defer release()
+	response, err := f.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &httpStatusError{statusCode: response.StatusCode, status: response.Status}
+	}
+	return nil
+}
+
+// reports whether the X-Hub-Signature header on pushed content was made with the subscription's secret
+func validWebSubSignature(secret string, header string, body []byte) bool {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	newHash, ok := webSubSignatures[strings.ToLower(method)]
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
+
+// the HTTP handler hubs call back to. The last part of the path is the subscription's id. GET requests
+// are the hub checking we meant to subscribe, and POST requests are new content. The database calls are
+// fields so the handler can be tested without a database
+type webSubCallback struct {
+	maxBodyBytes int64
+	lookup       func(ctx context.Context, id uuid.UUID) (database.WebsubSubscription, error)
+	verify       func(ctx context.Context, sub database.WebsubSubscription, leaseSeconds int) error
+	deny         func(ctx context.Context, sub database.WebsubSubscription) error
+	deliver      func(ctx context.Context, sub database.WebsubSubscription, body []byte, contentType string) error
+}
+
+// creates the callback handler backed by the database
+func newWebSubCallback(s *state) *webSubCallback {
+	return &webSubCallback{
+		maxBodyBytes: s.fetcher.maxBodyBytes,
+		lookup:       s.db.GetWebSubSubscription,
+		verify: func(ctx context.Context, sub database.WebsubSubscription, leaseSeconds int) error {
+			return s.db.VerifyWebSubSubscription(ctx, database.VerifyWebSubSubscriptionParams{
+				LeaseSeconds: int32(leaseSeconds),
+				ID:           sub.ID,
+			})
+		},
+		deny: func(ctx context.Context, sub database.WebsubSubscription) error {
+			return s.db.DeleteWebSubSubscription(ctx, sub.ID)
+		},
+		deliver: func(ctx context.Context, sub database.WebsubSubscription, body []byte, contentType string) error {
+			return deliverWebSub(ctx, s, sub, body, contentType)
+		},
+	}
+}
+
+func (c *webSubCallback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(path.Base(r.URL.Path))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	sub, err := c.lookup(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Gone tells the hub to stop sending content for a subscription we no longer have
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Could not look up WebSub subscription %v: %v\n", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		c.verifyIntent(w, r, sub)
+	case http.MethodPost:
+		c.receive(w, r, sub)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// answers a hub's verification of intent. A subscribe request for the topic we asked for is confirmed by
+// echoing the challenge, and a denied subscription is forgotten. Anything else is refused with a 404
+func (c *webSubCallback) verifyIntent(w http.ResponseWriter, r *http.Request, sub database.WebsubSubscription) {
+	query := r.URL.Query()
+	if query.Get("hub.topic") != sub.TopicUrl {
+		http.NotFound(w, r)
+		return
+	}
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		challenge := query.Get("hub.challenge")
+		if challenge == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lease, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+		if err != nil || lease <= 0 {
+			lease = webSubLeaseSeconds
+		}
+		err = c.verify(r.Context(), sub, lease)
+		if err != nil {
+			fmt.Printf("Could not verify the WebSub subscription to %v: %v\n", sub.TopicUrl, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Printf("WebSub subscription to %v verified for %v seconds\n", sub.TopicUrl, lease)
+		w.Write([]byte(challenge))
+	case "denied":
+		fmt.Printf("The hub denied the WebSub subscription to %v: %v\n", sub.TopicUrl, query.Get("hub.reason"))
+		err := c.deny(r.Context(), sub)
+		if err != nil {
+			fmt.Printf("Could not remove the WebSub subscription to %v: %v\n", sub.TopicUrl, err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// takes content pushed by the hub. Content without a valid signature is ignored, but the hub still gets
+// a 2xx as the spec asks, so it can't use the response to guess the secret
+func (c *webSubCallback) receive(w http.ResponseWriter, r *http.Request, sub database.WebsubSubscription) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c.maxBodyBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validWebSubSignature(sub.Secret, r.Header.Get("X-Hub-Signature"), body) {
+		fmt.Printf("Ignoring content for %v with a missing or invalid signature\n", sub.TopicUrl)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	err = c.deliver(r.Context(), sub, body, r.Header.Get("Content-Type"))
+	if err != nil {
+		fmt.Printf("Could not save content pushed for %v: %v\n", sub.TopicUrl, err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// saves the items in content pushed by a hub, the same way items from a fetched feed are saved
+func deliverWebSub(ctx context.Context, s *state, sub database.WebsubSubscription, body []byte, contentType string) error {
+	feed, err := s.db.GetFeedByID(ctx, sub.FeedID)
+	if err != nil {
+		return err
+	}
+	rssFeed, err := parseFetchedFeed(body, contentType)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v pushed %v items\n", feed.Name, len(rssFeed.Channel.Item))
+	_, err = saveItems(ctx, s, feed, rssFeed)
+	return err
+}
+
+// handles WebSub callbacks on a listener opened on the websub_listen address until ctx is cancelled, then
+// stops accepting callbacks and waits up to shutdown_timeout for any being handled to finish before
+// returning
+func serveWebSub(ctx context.Context, s *state, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           newWebSubCallback(s),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+	}
+	grace, err := s.cfg.ShutdownTimeoutDuration()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	shutdown := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(shutdown)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	fmt.Printf("Listening for WebSub callbacks on %v\n", listener.Addr())
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		// Serve returns as soon as the shutdown starts, not once the callbacks have finished
+		<-shutdown
+		return nil
+	}
+	return err
+}
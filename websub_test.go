@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ben-smith-404/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// signs a body the way a hub does for the X-Hub-Signature header
+func signWebSub(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestValidWebSubSignature checks that only content signed with the subscription's secret is accepted
+func TestValidWebSubSignature(t *testing.T) {
+	body := `<rss><channel></channel></rss>`
+	cases := []struct {
+		testName string
+		header   string
+		expect   bool
+	}{
+		{testName: "valid", header: signWebSub("secret", body), expect: true},
+		{testName: "wrong secret", header: signWebSub("other", body)},
+		{testName: "missing", header: ""},
+		{testName: "unknown method", header: "md5=abc"},
+		{testName: "not hex", header: "sha256=zzz"},
+	}
+	for _, c := range cases {
+		got := validWebSubSignature("secret", c.header, []byte(body))
+		if got != c.expect {
+			t.Errorf("Error testing %v: expected %v but got %v", c.testName, c.expect, got)
+		}
+	}
+}
+
+// TestWebSubSubscription runs a subscription against a stand-in hub. The hub verifies the subscription by
+// calling back with a challenge, then pushes one signed and one unsigned update
+func TestWebSubSubscription(t *testing.T) {
+	sub := database.WebsubSubscription{
+		ID:       uuid.New(),
+		TopicUrl: "https://example.com/feed.xml",
+		Secret:   "hub-secret",
+	}
+	verified := make(chan int, 1)
+	delivered := make(chan string, 2)
+	callback := httptest.NewServer(&webSubCallback{
+		maxBodyBytes: 1024 * 1024,
+		lookup: func(ctx context.Context, id uuid.UUID) (database.WebsubSubscription, error) {
+			if id != sub.ID {
+				return database.WebsubSubscription{}, sql.ErrNoRows
+			}
+			return sub, nil
+		},
+		verify: func(ctx context.Context, sub database.WebsubSubscription, leaseSeconds int) error {
+			verified <- leaseSeconds
+			return nil
+		},
+		deny: func(ctx context.Context, sub database.WebsubSubscription) error {
+			return nil
+		},
+		deliver: func(ctx context.Context, sub database.WebsubSubscription, body []byte, contentType string) error {
+			delivered <- string(body)
+			return nil
+		},
+	})
+	defer callback.Close()
+
+	hubErrors := make(chan string, 4)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("hub.mode") != "subscribe" || r.Form.Get("hub.topic") != sub.TopicUrl || r.Form.Get("hub.secret") != sub.Secret {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		callbackURL := r.Form.Get("hub.callback")
+		go func() {
+			query := url.Values{
+				"hub.mode":          {"subscribe"},
+				"hub.topic":         {sub.TopicUrl},
+				"hub.challenge":     {"challenge-123"},
+				"hub.lease_seconds": {"3600"},
+			}
+			response, err := http.Get(callbackURL + "?" + query.Encode())
+			if err != nil {
+				hubErrors <- err.Error()
+				return
+			}
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			if string(body) != "challenge-123" {
+				hubErrors <- "the callback answered the challenge with " + string(body)
+				return
+			}
+			updates := []struct{ body, signature string }{
+				{body: "forged", signature: "sha256=0000"},
+				{body: "signed", signature: signWebSub(sub.Secret, "signed")},
+			}
+			for _, update := range updates {
+				request, _ := http.NewRequest(http.MethodPost, callbackURL, strings.NewReader(update.body))
+				request.Header.Set("X-Hub-Signature", update.signature)
+				response, err := http.DefaultClient.Do(request)
+				if err != nil {
+					hubErrors <- err.Error()
+					return
+				}
+				response.Body.Close()
+				if response.StatusCode != http.StatusAccepted {
+					hubErrors <- "the callback answered content with " + response.Status
+				}
+			}
+		}()
+	}))
+	defer hub.Close()
+	sub.HubUrl = hub.URL
+
+	err := testFetcher(t).subscribeToHub(context.Background(), sub, webSubCallbackURL(callback.URL+"/websub/", sub.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case lease := <-verified:
+		if lease != 3600 {
+			t.Errorf("Error testing verification: expected a lease of 3600 but got %v", lease)
+		}
+	case message := <-hubErrors:
+		t.Fatal(message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error testing verification: the hub never verified the subscription")
+	}
+	select {
+	case body := <-delivered:
+		if body != "signed" {
+			t.Errorf("Error testing delivery: expected only the signed content but got %q", body)
+		}
+	case message := <-hubErrors:
+		t.Fatal(message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error testing delivery: the signed content was never delivered")
+	}
+
+	response, err := http.Post(webSubCallbackURL(callback.URL, uuid.New()), "application/rss+xml", strings.NewReader("stale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusGone {
+		t.Errorf("Error testing unknown subscription: expected %v but got %v", http.StatusGone, response.StatusCode)
+	}
+}